@@ -1,6 +1,8 @@
 package bat
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html"
@@ -8,6 +10,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/blakewilliams/bat/internal/lexer"
 	"github.com/blakewilliams/bat/internal/mapsort"
@@ -16,11 +19,28 @@ import (
 
 // Represents a single template that can be rendered.
 type Template struct {
-	name       string
-	ast        *parser.Node
-	helpers    map[string]any
-	escapeFunc func(string) string
-	raw        string
+	name             string
+	ast              *parser.Node
+	helpers          map[string]any
+	escapeFunc       func(string) string
+	raw              string
+	panicFallback    func(name string, err any) any
+	strict           bool
+	fallback         any
+	hasFallback      bool
+	leftDelim        string
+	rightDelim       string
+	collapse         bool
+	strictArithmetic bool
+	jsonTags         bool
+}
+
+// bufferPool holds buffers used to render templates to strings, avoiding an
+// allocation per render.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
 }
 
 // An escapeFunc that returns text as-is
@@ -34,6 +54,30 @@ var HTMLEscape func(s string) string = html.EscapeString
 // are derived from user input.
 type Safe string
 
+// Loop provides metadata about the current iteration of a range block. It is
+// available inside of range blocks as the `$loop` variable.
+type Loop struct {
+	// Index is the zero based index of the current iteration.
+	Index int
+	// Prev is the element from the previous iteration. It is nil on the first
+	// iteration and when ranging over maps.
+	Prev any
+	// Next is the element for the next iteration. It is nil on the last
+	// iteration and when ranging over maps or channels, since channels can't
+	// be read ahead of the current iteration.
+	Next any
+}
+
+// loopControl is returned by eval to signal that the innermost range should
+// stop iterating or skip the rest of the current iteration.
+type loopControl int
+
+const (
+	loopNone loopControl = iota
+	loopBreak
+	loopContinue
+)
+
 // A function that allows the template to be customized when using NewTemplate.
 type TemplateOption = func(*Template)
 
@@ -41,21 +85,53 @@ type TemplateOption = func(*Template)
 // customize the template, such as setting the function used to escape unsafe
 // input.
 func NewTemplate(name string, input string, opts ...TemplateOption) (Template, error) {
-	l := lexer.Lex(input)
+	t := Template{
+		name:       name,
+		raw:        input,
+		escapeFunc: HTMLEscape,
+		leftDelim:  lexer.DefaultLeftDelim,
+		rightDelim: lexer.DefaultRightDelim,
+	}
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	if t.strict && t.hasFallback {
+		return Template{}, errors.New("could not create template: WithStrictMode and WithFallbackValue can't be used together")
+	}
+
+	if err := validateDelimiters(t.leftDelim, t.rightDelim); err != nil {
+		return Template{}, fmt.Errorf("could not create template: %w", err)
+	}
+
+	l := lexer.LexWithDelimiters(input, t.leftDelim, t.rightDelim)
 	ast, err := parser.Parse(l)
 
 	if err != nil {
 		return Template{}, fmt.Errorf("could not create template: %w", err)
 	}
 
-	t := Template{name: name, raw: input, ast: ast, escapeFunc: HTMLEscape}
-	for _, opt := range opts {
-		opt(&t)
+	if t.collapse {
+		collapseWhitespace(ast)
 	}
 
+	t.ast = ast
+
 	return t, nil
 }
 
+// MustNewTemplate is like NewTemplate but panics if the template can't be
+// created. It is intended to be used when initializing package level
+// variables, e.g. `var index = bat.MustNewTemplate("index.html", src)`.
+func MustNewTemplate(name string, input string, opts ...TemplateOption) Template {
+	t, err := NewTemplate(name, input, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("bat: could not create template %s: %s", name, err))
+	}
+
+	return t
+}
+
 // Name returns the name of the template.
 func (t *Template) Name() string {
 	return t.name
@@ -63,9 +139,24 @@ func (t *Template) Name() string {
 
 // Executes the template, streaming output to out. The data parameter is made
 // available to the template.
-func (t *Template) Execute(out io.Writer, extraHelpers map[string]any, data map[string]any) (err error) {
+func (t *Template) Execute(out io.Writer, extraHelpers map[string]any, data map[string]any) error {
+	return t.ExecuteContext(context.Background(), out, extraHelpers, data)
+}
+
+// ExecuteContext executes the template like Execute, but stops executing and
+// returns ctx.Err() when the context is canceled. The context is checked
+// before each range iteration and function call, so output written before the
+// context was canceled will still be present in out.
+func (t *Template) ExecuteContext(ctx context.Context, out io.Writer, extraHelpers map[string]any, data map[string]any) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			// Cancellation can be wrapped by helpers, like partial, so
+			// prefer the context's error when it's been canceled.
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				return
+			}
+
 			switch val := r.(type) {
 			case string:
 				err = errors.New(val)
@@ -77,6 +168,10 @@ func (t *Template) Execute(out io.Writer, extraHelpers map[string]any, data map[
 
 	helpers := make(map[string]any, len(t.helpers)+len(extraHelpers))
 	for k, v := range t.helpers {
+		if h, ok := v.(templateHelper); ok {
+			v = h(t)
+		}
+
 		helpers[k] = v
 	}
 
@@ -84,14 +179,33 @@ func (t *Template) Execute(out io.Writer, extraHelpers map[string]any, data map[
 		helpers[k] = v
 	}
 
+	// Slots are stored in the render state so that layouts can yield them
+	ctx, _ = withRenderState(ctx)
+
 	// TODO validate no overlaps, log or raise?
+	vars := make(map[string]any)
 	for _, child := range t.ast.Children {
-		t.eval(child, out, data, helpers, make(map[string]any))
+		t.eval(ctx, child, out, data, helpers, vars)
 	}
 
 	return nil
 }
 
+// ExecuteString executes the template and returns the output as a string.
+func (t *Template) ExecuteString(extraHelpers map[string]any, data map[string]any) (string, error) {
+	b := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		b.Reset()
+		bufferPool.Put(b)
+	}()
+
+	if err := t.Execute(b, extraHelpers, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
 // An option function that provides a custom escape function that is used to
 // escape unsafe dynamic template values.
 func WithEscapeFunc(fn func(string) string) func(*Template) {
@@ -100,127 +214,506 @@ func WithEscapeFunc(fn func(string) string) func(*Template) {
 	}
 }
 
+// WithHelperPanicFallback provides a function that is called when a helper
+// panics. Instead of failing the render, the value returned by fn is used as
+// the result of the helper call and rendering continues.
+func WithHelperPanicFallback(fn func(name string, err any) any) TemplateOption {
+	return func(t *Template) {
+		t.panicFallback = fn
+	}
+}
+
+// WithStrictMode causes execution to fail when the template references data
+// that isn't provided and isn't a helper, instead of rendering nothing.
+func WithStrictMode() TemplateOption {
+	return func(t *Template) {
+		t.strict = true
+	}
+}
+
+// WithStrictArithmetic makes math on numbers of different types an error, e.g.
+// multiplying an int by a float64, instead of converting them to the same type.
+// Values can be converted with the int and float helpers.
+func WithStrictArithmetic() TemplateOption {
+	return func(t *Template) {
+		t.strictArithmetic = true
+	}
+}
+
+// withJSONTags allows structs to be accessed using brackets and the names in
+// their json tags, see WithJSONTagAccess.
+func withJSONTags(enabled bool) TemplateOption {
+	return func(t *Template) {
+		t.jsonTags = enabled
+	}
+}
+
+// WithFallbackValue provides a value that is used in place of data that
+// isn't provided and isn't a helper. It can't be combined with WithStrictMode.
+func WithFallbackValue(v any) TemplateOption {
+	return func(t *Template) {
+		t.fallback = v
+		t.hasFallback = true
+	}
+}
+
+// WithDelimiters sets the delimiters used to mark actions in the template,
+// which default to `{{` and `}}`. This is useful when the template output
+// contains the default delimiters, like templates that render other
+// templates. Each delimiter must be at least two characters long and neither
+// can contain the other.
+func WithDelimiters(left string, right string) TemplateOption {
+	return func(t *Template) {
+		t.leftDelim = left
+		t.rightDelim = right
+	}
+}
+
+// validateDelimiters returns an error when left and right can't be used to
+// unambiguously find actions in a template.
+func validateDelimiters(left string, right string) error {
+	if len(left) < 2 || len(right) < 2 {
+		return fmt.Errorf("delimiters %q and %q must be at least two characters", left, right)
+	}
+
+	if strings.Contains(left, right) || strings.Contains(right, left) {
+		return fmt.Errorf("delimiters %q and %q can't contain each other", left, right)
+	}
+
+	return nil
+}
+
+// withCollapseWhitespace collapses runs of whitespace in the template's text,
+// see WithCollapseWhitespace.
+func withCollapseWhitespace(collapse bool) TemplateOption {
+	return func(t *Template) {
+		t.collapse = collapse
+	}
+}
+
+// templateHelper creates a helper that depends on the template executing it,
+// e.g. to escape values using the template's escape function. It's called each
+// time the template is executed.
+type templateHelper func(t *Template) any
+
 func WithHelpers(fns map[string]any) TemplateOption {
 	return func(t *Template) {
 		t.helpers = fns
 	}
 }
 
-func (t *Template) eval(n *parser.Node, out io.Writer, data map[string]any, helpers map[string]any, vars map[string]any) {
+func (t *Template) eval(ctx context.Context, n *parser.Node, out io.Writer, data map[string]any, helpers map[string]any, vars map[string]any) loopControl {
 	switch n.Kind {
 	case parser.KindText:
 		out.Write([]byte(n.Value))
 	case parser.KindNot:
-		value := t.access(n, data, helpers, vars)
+		value := t.access(ctx, n, data, helpers, vars)
 		out.Write([]byte(valueToString(value, t.escapeFunc)))
 	case parser.KindString:
 		out.Write([]byte(n.Value)[1 : len(n.Value)-1])
 	case parser.KindStatement:
-		t.eval(n.Children[0], out, data, helpers, vars)
-	case parser.KindAccess, parser.KindNegate, parser.KindBracketAccess:
-		value := t.access(n, data, helpers, vars)
+		return t.eval(ctx, n.Children[0], out, data, helpers, vars)
+	case parser.KindBreak:
+		return loopBreak
+	case parser.KindContinue:
+		return loopContinue
+	case parser.KindAccess, parser.KindNegate, parser.KindBracketAccess, parser.KindSlice:
+		value := t.access(ctx, n, data, helpers, vars)
 
 		out.Write([]byte(valueToString(value, t.escapeFunc)))
-	case parser.KindIdentifier, parser.KindVariable, parser.KindInt, parser.KindInfix, parser.KindCall, parser.KindMap:
-		value := t.access(n, data, helpers, vars)
+	case parser.KindIdentifier, parser.KindVariable, parser.KindInt, parser.KindInfix, parser.KindCall, parser.KindMap, parser.KindList, parser.KindContext, parser.KindTernary, parser.KindNullCoalesce, parser.KindDefined:
+		value := t.access(ctx, n, data, helpers, vars)
 
 		out.Write([]byte(valueToString(value, t.escapeFunc)))
 	case parser.KindIf:
-		conditionResult := t.access(n.Children[0], data, helpers, vars)
+		conditionResult := t.access(ctx, n.Children[0], data, helpers, vars)
 		v := reflect.ValueOf(conditionResult)
 
 		if isTruthy(v) {
-			t.eval(n.Children[1], out, data, helpers, vars)
+			return t.eval(ctx, n.Children[1], out, data, helpers, vars)
 		} else if len(n.Children) > 2 && n.Children[2] != nil {
-			t.eval(n.Children[2], out, data, helpers, vars)
+			return t.eval(ctx, n.Children[2], out, data, helpers, vars)
+		}
+	case parser.KindWith:
+		expression := n.Children[0]
+		if expression.Kind == parser.KindAssign {
+			expression = expression.Children[1]
+		}
+		value := t.access(ctx, expression, data, helpers, vars)
+
+		// Empty values have nothing to scope to, so the else block is
+		// rendered instead, if present
+		if isEmpty(reflect.ValueOf(value)) {
+			if len(n.Children) > 2 {
+				return t.eval(ctx, n.Children[2], out, data, helpers, vars)
+			}
+
+			return loopNone
+		}
+
+		newVars := make(map[string]any, len(vars)+1)
+		for k, v := range vars {
+			newVars[k] = v
 		}
+		newVars["."] = value
+		bound := "."
+		if n.Children[0].Kind == parser.KindAssign {
+			bound = n.Children[0].Children[0].Value
+			newVars[bound] = value
+		}
+		defer writeBack(vars, newVars, ".", bound)
+
+		return t.eval(ctx, n.Children[1], out, data, helpers, newVars)
 	case parser.KindBlock:
+		scoped, copied := blockScope(n, vars)
+		if copied {
+			defer writeBack(vars, scoped)
+		}
+
 		for _, child := range n.Children {
-			t.eval(child, out, data, helpers, vars)
+			if control := t.eval(ctx, child, out, data, helpers, scoped); control != loopNone {
+				return control
+			}
+		}
+	case parser.KindSwitch:
+		subject := reflect.ValueOf(t.access(ctx, n.Children[0], data, helpers, vars))
+
+		for _, child := range n.Children[1:] {
+			// The else block has no values to compare against
+			if child.Kind == parser.KindBlock {
+				return t.eval(ctx, child, out, data, helpers, vars)
+			}
+
+			values := child.Children[:len(child.Children)-1]
+			for _, value := range values {
+				if compare(subject, reflect.ValueOf(t.access(ctx, value, data, helpers, vars))) {
+					return t.eval(ctx, child.Children[len(child.Children)-1], out, data, helpers, vars)
+				}
+			}
+		}
+	case parser.KindDo:
+		for _, child := range n.Children {
+			t.eval(ctx, child, io.Discard, data, helpers, vars)
+		}
+	case parser.KindSlot:
+		name := valueToString(t.access(ctx, n.Children[0], data, helpers, vars), NoEscape)
+
+		var b bytes.Buffer
+		control := t.eval(ctx, n.Children[1], &b, data, helpers, vars)
+
+		// Content is appended so that partials can add to the same slot
+		_, state := withRenderState(ctx)
+		state.slots[name] += b.String()
+
+		return control
+	case parser.KindRaw:
+		out.Write([]byte(n.Value))
+	case parser.KindCapture:
+		var b bytes.Buffer
+		control := t.eval(ctx, n.Children[1], &b, data, helpers, vars)
+
+		// The output was escaped while rendering, so it's safe
+		vars[n.Children[0].Value] = Safe(b.String())
+
+		return control
+	case parser.KindDefine:
+		name := valueToString(t.access(ctx, n.Children[0], data, helpers, vars), NoEscape)
+
+		// Templates are rendered before their layouts, so the first
+		// definition is from the most specific template and is kept.
+		_, state := withRenderState(ctx)
+		if _, ok := state.blocks[name]; ok {
+			return loopNone
 		}
+
+		var b bytes.Buffer
+		control := t.eval(ctx, n.Children[1], &b, data, helpers, vars)
+		state.blocks[name] = b.String()
+
+		return control
+	case parser.KindBlockDef:
+		name := valueToString(t.access(ctx, n.Children[0], data, helpers, vars), NoEscape)
+
+		_, state := withRenderState(ctx)
+		if content, ok := state.blocks[name]; ok {
+			out.Write([]byte(content))
+			return loopNone
+		}
+
+		return t.eval(ctx, n.Children[1], out, data, helpers, vars)
+	case parser.KindYield:
+		// yield without a name outputs the content of the child template
+		if len(n.Children) == 0 {
+			out.Write([]byte(valueToString(data["ChildContent"], t.escapeFunc)))
+			return loopNone
+		}
+
+		name := valueToString(t.access(ctx, n.Children[0], data, helpers, vars), NoEscape)
+
+		// Slot content was escaped when it was captured, and slots that
+		// weren't defined are empty
+		_, state := withRenderState(ctx)
+		out.Write([]byte(state.slots[name]))
+	case parser.KindAssign:
+		vars[n.Children[0].Value] = t.access(ctx, n.Children[1], data, helpers, vars)
 	case parser.KindRange:
 		newVars := make(map[string]any, len(vars)+2)
 		for k, v := range vars {
 			newVars[k] = v
 		}
 
-		iteratorName := n.Children[0].Value
-		valueName := n.Children[1].Value
+		r := splitRange(n)
+		iteratorName := r.key
+		valueName := r.value
+		body := r.body
+		elseBody := r.elseBody
+		defer writeBack(vars, newVars, ".", "$loop", iteratorName, valueName)
+
+		limit := -1
+		iterations := 0
+
+		// Integer ranges are iterated over directly instead of allocating a
+		// slice of every integer in the range.
+		if r.iterable.Kind == parser.KindIntRange {
+			start := t.intBound(ctx, r.iterable.Children[0], data, helpers, vars, "range")
+			end := t.intBound(ctx, r.iterable.Children[1], data, helpers, vars, "range")
+			if r.limit != nil {
+				limit = t.rangeLimit(ctx, r.limit, data, helpers, vars)
+			}
+
+			step := 1
+			if start > end {
+				step = -1
+			}
 
-		var toLoop any
-		var body *parser.Node
+			length := (end - start) * step
+			if limit >= 0 && limit < length {
+				length = limit
+			}
 
-		if len(n.Children) == 4 {
-			toLoop = t.access(n.Children[2], data, helpers, vars)
-			body = n.Children[3]
-		} else {
-			toLoop = t.access(n.Children[1], data, helpers, vars)
-			body = n.Children[2]
+			for i := 0; i < length; i++ {
+				checkContext(ctx)
+
+				value := start + i*step
+				loop := Loop{Index: i}
+				if i > 0 {
+					loop.Prev = value - step
+				}
+				if i < length-1 {
+					loop.Next = value + step
+				}
+
+				newVars["$loop"] = loop
+				if iteratorName != "" {
+					newVars[iteratorName] = i
+				}
+				if valueName != "" {
+					newVars[valueName] = value
+				}
+				newVars["."] = value
+
+				iterations++
+				if t.eval(ctx, body, out, data, helpers, newVars) == loopBreak {
+					break
+				}
+			}
+
+			if iterations == 0 && elseBody != nil {
+				return t.eval(ctx, elseBody, out, data, helpers, vars)
+			}
+
+			return loopNone
 		}
 
+		// The iterable is evaluated before ranging, so it can be any
+		// expression, including calls.
+		toLoop := t.access(ctx, r.iterable, data, helpers, vars)
 		v := reflect.ValueOf(toLoop)
 
+		if r.limit != nil {
+			limit = t.rangeLimit(ctx, r.limit, data, helpers, vars)
+		}
+
 		switch v.Kind() {
 		case reflect.Slice, reflect.Array:
-			for i := 0; i < v.Len(); i++ {
-				newVars[iteratorName] = i
-				newVars[valueName] = v.Index(i).Interface()
+			length := v.Len()
+			if limit >= 0 && limit < length {
+				length = limit
+			}
 
-				t.eval(body, out, data, helpers, newVars)
+			for i := 0; i < length; i++ {
+				checkContext(ctx)
+
+				loop := Loop{Index: i}
+				if i > 0 {
+					loop.Prev = v.Index(i - 1).Interface()
+				}
+				if i < length-1 {
+					loop.Next = v.Index(i + 1).Interface()
+				}
+
+				newVars["$loop"] = loop
+				if iteratorName != "" {
+					newVars[iteratorName] = i
+				}
+				if valueName != "" {
+					newVars[valueName] = v.Index(i).Interface()
+				}
+				newVars["."] = v.Index(i).Interface()
+
+				iterations++
+				if t.eval(ctx, body, out, data, helpers, newVars) == loopBreak {
+					break
+				}
 			}
 		case reflect.Map:
 			sorted := mapsort.Sort(v)
 
 			for i := range sorted.Keys {
+				if i == limit {
+					break
+				}
+				checkContext(ctx)
+
+				newVars["$loop"] = Loop{Index: i}
 				newVars[iteratorName] = sorted.Keys[i].Interface()
-				newVars[valueName] = sorted.Values[i].Interface()
+				if valueName != "" {
+					newVars[valueName] = sorted.Values[i].Interface()
+				}
+				newVars["."] = sorted.Values[i].Interface()
 
-				t.eval(body, out, data, helpers, newVars)
+				iterations++
+				if t.eval(ctx, body, out, data, helpers, newVars) == loopBreak {
+					break
+				}
 			}
 		case reflect.Chan:
 			defaultCase := reflect.SelectCase{Dir: reflect.SelectDefault}
 			recvCase := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: v}
 
 			i := 0
+			var prev any
 			cases := []reflect.SelectCase{defaultCase, recvCase}
-			for {
+			for i != limit {
 				chosen, value, ok := reflect.Select(cases)
 
 				if chosen == 0 || !ok {
 					break
 				}
+				checkContext(ctx)
+
+				newVars["$loop"] = Loop{Index: i, Prev: prev}
+				prev = value.Interface()
 				newVars[iteratorName] = i
-				newVars[valueName] = value.Interface()
-				t.eval(body, out, data, helpers, newVars)
+				if valueName != "" {
+					newVars[valueName] = value.Interface()
+				}
+				newVars["."] = value.Interface()
 				i++
+				if t.eval(ctx, body, out, data, helpers, newVars) == loopBreak {
+					break
+				}
+			}
+			iterations = i
+		case reflect.Invalid:
+			// nil values are treated as empty when there's an else block
+			if elseBody == nil {
+				t.panicWithTrace(n, fmt.Sprintf("attempted to range over %s", v.Kind()))
 			}
 		default:
 			t.panicWithTrace(n, fmt.Sprintf("attempted to range over %s", v.Kind()))
 		}
+
+		if iterations == 0 && elseBody != nil {
+			return t.eval(ctx, elseBody, out, data, helpers, vars)
+		}
 	default:
 		t.panicWithTrace(n, fmt.Sprintf("unsupported kind %s", n.Kind))
 	}
+
+	return loopNone
 }
 
-func (t *Template) access(n *parser.Node, data map[string]any, helpers map[string]any, vars map[string]any) any {
+func (t *Template) access(ctx context.Context, n *parser.Node, data map[string]any, helpers map[string]any, vars map[string]any) any {
 	switch n.Kind {
 	case parser.KindCall:
-		toCall := reflect.ValueOf(t.access(n.Children[0], data, helpers, vars))
+		var toCall reflect.Value
+		if n.Children[0].Kind == parser.KindIdentifier {
+			// Missing functions are reported below, so they skip strict mode
+			// and fallback values.
+			fn, _ := lookup(n.Children[0].Value, data, helpers)
+			toCall = reflect.ValueOf(fn)
+		} else {
+			toCall = reflect.ValueOf(t.access(ctx, n.Children[0], data, helpers, vars))
+		}
+
 		args := make([]reflect.Value, 0, len(n.Children)-1)
 		for _, arg := range n.Children[1:] {
-			args = append(args, reflect.ValueOf(t.access(arg, data, helpers, vars)))
+			args = append(args, reflect.ValueOf(t.access(ctx, arg, data, helpers, vars)))
 		}
 
+		name := callName(n.Children[0])
 		if !toCall.IsValid() {
-			t.panicWithTrace(n.Children[0], fmt.Sprintf("function '%s' not defined", n.Children[0].Value))
+			// Calls on an optional chain short-circuit to nil, like accesses.
+			if isOptionalChain(n.Children[0]) {
+				return nil
+			}
+
+			t.panicWithTrace(n.Children[0], fmt.Sprintf("function '%s' not defined", name))
+		}
+
+		if toCall.Kind() == reflect.Func {
+			fnType := toCall.Type()
+
+			if fnType.IsVariadic() && len(args) < fnType.NumIn()-1 {
+				t.panicWithTrace(n.Children[0], fmt.Sprintf("function '%s' expects at least %d arguments, got %d", name, fnType.NumIn()-1, len(args)))
+			}
+
+			for i, arg := range args {
+				paramType := funcParam(fnType, i)
+				if paramType == nil {
+					continue
+				}
+
+				// nil arguments have to be converted to the zero value of the
+				// parameter since reflect can't call functions with invalid values
+				if !arg.IsValid() {
+					args[i] = reflect.Zero(paramType)
+					continue
+				}
+
+				converted, ok := convertArg(arg, paramType)
+				if !ok {
+					t.panicWithTrace(n.Children[i+1], fmt.Sprintf("argument %d to function '%s' must be %s, got %s", i+1, name, paramType, arg.Type()))
+				}
+
+				args[i] = converted
+			}
 		}
 
+		checkContext(ctx)
+
 		// Wrap the call in a closure to allow for the possibility of panics so
 		// we can provide good error messages
-		return func() any {
+		return func() (result any) {
 			defer func() {
 				if err := recover(); err != nil {
-					t.panicWithTrace(n.Children[0], fmt.Sprintf("error calling function '%s': %s", n.Children[0].Value, err))
+					// Partial errors are annotated with where the partial
+					// was included from.
+					if partialErr, ok := err.(*PartialError); ok {
+						partialErr.IncludedFrom = t.Name()
+						partialErr.IncludedFromLine = n.StartLine
+						panic(partialErr)
+					}
+
+					// Cancellation should always stop execution, so the
+					// fallback is only used for other panics.
+					if t.panicFallback != nil && ctx.Err() == nil {
+						result = t.panicFallback(name, err)
+						return
+					}
+
+					t.panicWithTrace(n.Children[0], fmt.Sprintf("error calling function '%s': %s", name, err))
 				}
 			}()
 
@@ -232,7 +725,7 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 			}
 		}()
 	case parser.KindNegate:
-		value := t.access(n.Children[0], data, helpers, vars)
+		value := t.access(ctx, n.Children[0], data, helpers, vars)
 		switch reflect.ValueOf(value).Kind() {
 		case reflect.Int:
 			return value.(int) * -1
@@ -255,7 +748,7 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 			return nil
 		}
 	case parser.KindNot:
-		value := t.access(n.Children[0], data, helpers, vars)
+		value := t.access(ctx, n.Children[0], data, helpers, vars)
 
 		if value == nil || value == false {
 			return true
@@ -269,11 +762,22 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 	case parser.KindNil:
 		return nil
 	case parser.KindInt:
-		val, _ := strconv.Atoi(n.Value)
-		return val
+		// The lexer validates numbers, so this can't fail
+		val, _ := strconv.ParseInt(n.Value, 0, 64)
+		return int(val)
 	case parser.KindInfix:
-		left := t.access(n.Children[0], data, helpers, vars)
-		right := t.access(n.Children[2], data, helpers, vars)
+		left := t.access(ctx, n.Children[0], data, helpers, vars)
+
+		// Logical operators short-circuit, so the right side is only
+		// evaluated when needed.
+		switch n.Children[1].Value {
+		case "&&":
+			return isTruthy(reflect.ValueOf(left)) && isTruthy(reflect.ValueOf(t.access(ctx, n.Children[2], data, helpers, vars)))
+		case "||":
+			return isTruthy(reflect.ValueOf(left)) || isTruthy(reflect.ValueOf(t.access(ctx, n.Children[2], data, helpers, vars)))
+		}
+
+		right := t.access(ctx, n.Children[2], data, helpers, vars)
 
 		switch n.Children[1].Value {
 		case "!=":
@@ -281,15 +785,27 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 		case "==":
 			return compare(reflect.ValueOf(left), reflect.ValueOf(right))
 		case "-":
-			return subtract(left, right)
+			return subtract(left, right, t.strictArithmetic)
 		case "+":
-			return add(left, right, t.escapeFunc)
+			return add(left, right, t.escapeFunc, t.strictArithmetic)
 		case "*":
-			return multiply(left, right)
+			return multiply(left, right, t.strictArithmetic)
 		case "/":
-			return divide(left, right)
+			return divide(left, right, t.strictArithmetic)
 		case "%":
-			return modulo(left, right)
+			return modulo(left, right, t.strictArithmetic)
+		case "&", "^", "<<", ">>":
+			val, err := bitwise(n.Children[1].Value, left, right)
+			if err != nil {
+				t.panicWithTrace(n, err.Error())
+			}
+			return val
+		case "in":
+			val, err := contains(right, left)
+			if err != nil {
+				t.panicWithTrace(n, err.Error())
+			}
+			return val
 		case "<":
 			val, err := lessThan(left, right)
 			if err != nil {
@@ -321,37 +837,63 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 		}
 
 	case parser.KindIdentifier:
-		if val, ok := data[n.Value]; ok {
+		if val, ok := lookup(n.Value, data, helpers); ok {
 			return val
 		}
 
-		if val, ok := helpers[n.Value]; ok {
-			return val
+		if t.strict {
+			t.panicWithTrace(n, fmt.Sprintf("undefined variable '%s'", n.Value))
+		}
+
+		if t.hasFallback {
+			return t.fallback
 		}
 
 		return nil
 	case parser.KindVariable:
 		return vars[n.Value]
+	case parser.KindContext:
+		return vars["."]
+	case parser.KindDefined:
+		name := n.Children[0]
+		if name.Kind == parser.KindVariable {
+			_, ok := vars[name.Value]
+			return ok
+		}
+
+		_, ok := data[name.Value]
+		return ok
 	case parser.KindMap:
 		m := make(map[string]any, len(n.Children))
 
 		for _, child := range n.Children {
-			key := child.Children[0]
+			key := t.mapKey(ctx, child.Children[0], data, helpers, vars)
 			value := child.Children[1]
 
 			// This can be invalid, so we need to check it
-			rVal := reflect.ValueOf(t.access(value, data, helpers, vars))
+			rVal := reflect.ValueOf(t.access(ctx, value, data, helpers, vars))
 			if rVal.IsValid() {
-				m[key.Value] = rVal.Interface()
+				m[key] = rVal.Interface()
 			} else {
-				m[key.Value] = nil
+				m[key] = nil
 			}
 		}
 
 		return m
+	case parser.KindList:
+		list := make([]any, 0, len(n.Children))
+
+		for _, child := range n.Children {
+			list = append(list, t.access(ctx, child, data, helpers, vars))
+		}
+
+		return list
 	case parser.KindBracketAccess:
-		root := t.access(n.Children[0], data, helpers, vars)
-		accessor := t.access(n.Children[1], data, helpers, vars)
+		root := t.access(ctx, n.Children[0], data, helpers, vars)
+		if isOptionalChain(n.Children[0]) && isNil(reflect.ValueOf(root)) {
+			return nil
+		}
+		accessor := t.access(ctx, n.Children[1], data, helpers, vars)
 
 		rootVal := reflect.ValueOf(root)
 		accessorVal := reflect.ValueOf(accessor)
@@ -383,35 +925,68 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 
 			return value.Interface()
 		case reflect.Slice, reflect.Array:
-			switch accessorVal.Kind() {
-			case reflect.Int:
-				return rootVal.Index(accessor.(int)).Interface()
-			case reflect.Int16:
-				return rootVal.Index(int(accessor.(int16))).Interface()
-			case reflect.Int32:
-				return rootVal.Index(int(accessor.(int32))).Interface()
-			case reflect.Int64:
-				return rootVal.Index(int(accessor.(int64))).Interface()
-			case reflect.Uint:
-				return rootVal.Index(int(accessor.(uint))).Interface()
-			case reflect.Uint16:
-				return rootVal.Index(int(accessor.(uint16))).Interface()
-			case reflect.Uint32:
-				return rootVal.Index(int(accessor.(uint32))).Interface()
-			case reflect.Uint64:
-				return rootVal.Index(int(accessor.(uint64))).Interface()
+			var index int
+			switch genericType(accessorVal) {
+			case coreInt:
+				index = int(accessorVal.Int())
+			case coreUint:
+				index = int(accessorVal.Uint())
 			default:
 				t.panicWithTrace(n, fmt.Sprintf("can't index %s with %s", rootVal.Kind(), accessorVal.Kind()))
 				return nil
 			}
+
+			// negative indexes count from the end, e.g. foo[-1] is the last
+			// element
+			if index < 0 {
+				index += rootVal.Len()
+			}
+
+			if index < 0 || index >= rootVal.Len() {
+				t.panicWithTrace(n, fmt.Sprintf("index %v out of range with length %d", accessor, rootVal.Len()))
+				return nil
+			}
+
+			return rootVal.Index(index).Interface()
 		default:
+			if t.jsonTags {
+				if structVal := reflect.Indirect(rootVal); structVal.Kind() == reflect.Struct && accessorVal.Kind() == reflect.String {
+					field, ok := jsonField(structVal.Type(), accessorVal.String())
+					if !ok {
+						t.panicWithTrace(n, fmt.Sprintf("no field with json name '%s' for type %s", accessorVal.String(), structVal.Type()))
+					}
+
+					return structVal.FieldByIndex(field.Index).Interface()
+				}
+			}
+
 			t.panicWithTrace(n, "cannot index non-map/non-slice")
 			return nil
 		}
+	case parser.KindNullCoalesce:
+		// Unlike conditions, only nil values are replaced, so falsy values
+		// like 0 and "" are kept.
+		if value := t.access(ctx, n.Children[0], data, helpers, vars); !isNil(reflect.ValueOf(value)) {
+			return value
+		}
+
+		return t.access(ctx, n.Children[1], data, helpers, vars)
+	case parser.KindTernary:
+		condition := t.access(ctx, n.Children[0], data, helpers, vars)
+
+		if isTruthy(reflect.ValueOf(condition)) {
+			return t.access(ctx, n.Children[1], data, helpers, vars)
+		}
+
+		return t.access(ctx, n.Children[2], data, helpers, vars)
 	case parser.KindAccess:
-		root := t.access(n.Children[0], data, helpers, vars)
+		root := t.access(ctx, n.Children[0], data, helpers, vars)
 		propName := n.Children[1].Value
 
+		if n.Value == parser.OptionalAccess && isNil(reflect.ValueOf(root)) {
+			return nil
+		}
+
 		if root == nil {
 			t.panicWithTrace(n, fmt.Sprintf("attempted to access property `%s` on nil value on line %d", propName, n.StartLine))
 			return nil
@@ -443,12 +1018,49 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 
 		switch k {
 		case reflect.Map:
+			// Missing keys are nil, like bracket access, so that optional
+			// chains short-circuit on them.
 			value := v.MapIndex(reflect.ValueOf(propName))
+			if !value.IsValid() {
+				return nil
+			}
+
 			return value.Interface()
 		default:
 			t.panicWithTrace(n, fmt.Sprintf("access on type %s on line %d", k, n.StartLine))
 			return nil
 		}
+	case parser.KindSlice:
+		root := reflect.ValueOf(t.access(ctx, n.Children[0], data, helpers, vars))
+
+		switch root.Kind() {
+		case reflect.String, reflect.Slice:
+		case reflect.Array:
+			// arrays must be addressable to be sliced
+			if !root.CanAddr() {
+				addressable := reflect.New(root.Type()).Elem()
+				addressable.Set(root)
+				root = addressable
+			}
+		default:
+			t.panicWithTrace(n, fmt.Sprintf("cannot slice %s", root.Kind()))
+		}
+
+		low := 0
+		if n.Children[1] != nil {
+			low = t.intBound(ctx, n.Children[1], data, helpers, vars, "slice")
+		}
+
+		high := root.Len()
+		if n.Children[2] != nil {
+			high = t.intBound(ctx, n.Children[2], data, helpers, vars, "slice")
+		}
+
+		if low < 0 || high < low || high > root.Len() {
+			t.panicWithTrace(n, fmt.Sprintf("slice bounds [%d:%d] out of range with length %d", low, high, root.Len()))
+		}
+
+		return root.Slice(low, high).Interface()
 	case parser.KindString:
 		// Cut off opening " and closing "
 		return n.Value[1 : len(n.Value)-1]
@@ -458,6 +1070,252 @@ func (t *Template) access(n *parser.Node, data map[string]any, helpers map[strin
 	}
 }
 
+// intBound evaluates n and returns it as an int, panicking if it isn't an
+// integer. The kind of bound, e.g. "range" or "slice", is used in the error.
+func (t *Template) intBound(ctx context.Context, n *parser.Node, data map[string]any, helpers map[string]any, vars map[string]any, kind string) int {
+	v := reflect.ValueOf(t.access(ctx, n, data, helpers, vars))
+
+	switch genericType(v) {
+	case coreInt:
+		return int(v.Int())
+	case coreUint:
+		return int(v.Uint())
+	default:
+		t.panicWithTrace(n, fmt.Sprintf("%s bounds must be integers, got %s", kind, v.Kind()))
+		return 0
+	}
+}
+
+// rangeLimit evaluates the limit of a range statement, panicking if it isn't
+// a non-negative integer.
+func (t *Template) rangeLimit(ctx context.Context, n *parser.Node, data map[string]any, helpers map[string]any, vars map[string]any) int {
+	v := reflect.ValueOf(t.access(ctx, n, data, helpers, vars))
+
+	limit := -1
+	switch genericType(v) {
+	case coreInt:
+		limit = int(v.Int())
+	case coreUint:
+		limit = int(v.Uint())
+	default:
+		t.panicWithTrace(n, fmt.Sprintf("range limit must be an integer, got %s", v.Kind()))
+	}
+
+	if limit < 0 {
+		t.panicWithTrace(n, fmt.Sprintf("range limit must not be negative, got %d", limit))
+	}
+
+	return limit
+}
+
+// rangeNode holds the parts of a KindRange node.
+type rangeNode struct {
+	key      string
+	value    string
+	iterable *parser.Node
+	limit    *parser.Node
+	body     *parser.Node
+	elseBody *parser.Node
+}
+
+// splitRange returns the parts of a KindRange node, since the number of
+// children varies depending on the variables and blocks provided.
+func splitRange(n *parser.Node) rangeNode {
+	r := rangeNode{key: n.Children[0].Value}
+
+	children := n.Children
+	for i, child := range children {
+		if child.Kind == parser.KindLimit {
+			r.limit = child.Children[0]
+			children = append(children[:i:i], children[i+1:]...)
+			break
+		}
+	}
+
+	var blocks []*parser.Node
+	if children[2].Kind == parser.KindBlock {
+		r.iterable = children[1]
+		blocks = children[2:]
+	} else {
+		r.value = children[1].Value
+		r.iterable = children[2]
+		blocks = children[3:]
+	}
+
+	r.body = blocks[0]
+	if len(blocks) > 1 {
+		r.elseBody = blocks[1]
+	}
+
+	// A single variable ranging over integers is bound to the integer instead
+	// of the index.
+	if r.iterable.Kind == parser.KindIntRange && r.value == "" {
+		r.key, r.value = "", r.key
+	}
+
+	return r
+}
+
+// mapKey returns the string key for the given map literal key node.
+func (t *Template) mapKey(ctx context.Context, n *parser.Node, data map[string]any, helpers map[string]any, vars map[string]any) string {
+	switch n.Kind {
+	case parser.KindString:
+		return n.Value[1 : len(n.Value)-1]
+	case parser.KindComputedKey:
+		return valueToString(t.access(ctx, n.Children[0], data, helpers, vars), NoEscape)
+	default:
+		return n.Value
+	}
+}
+
+// lookup returns the data or helper with the given name, preferring data.
+func lookup(name string, data map[string]any, helpers map[string]any) (any, bool) {
+	if val, ok := data[name]; ok {
+		return val, true
+	}
+
+	val, ok := helpers[name]
+
+	return val, ok
+}
+
+// callName returns the name of the function being called, e.g. `Items` for
+// `n?.Items()`.
+func callName(callee *parser.Node) string {
+	if callee.Kind == parser.KindAccess {
+		return callee.Children[1].Value
+	}
+
+	return callee.Value
+}
+
+// isOptionalChain returns true if the given node follows a `?.` access, in which
+// case a nil value short-circuits the rest of the chain.
+func isOptionalChain(n *parser.Node) bool {
+	switch n.Kind {
+	case parser.KindAccess:
+		return n.Value == parser.OptionalAccess
+	case parser.KindCall, parser.KindBracketAccess:
+		return isOptionalChain(n.Children[0])
+	}
+
+	return false
+}
+
+// funcParam returns the type of the i-th parameter of the given function type,
+// or nil if the function doesn't accept that many arguments.
+func funcParam(fn reflect.Type, i int) reflect.Type {
+	if fn.IsVariadic() && i >= fn.NumIn()-1 {
+		return fn.In(fn.NumIn() - 1).Elem()
+	}
+
+	if i < fn.NumIn() {
+		return fn.In(i)
+	}
+
+	return nil
+}
+
+// convertArg converts arg to the type of a function parameter. Values are
+// converted between numeric types and between string types, e.g. int to int64
+// or Safe to string, but not between kinds since converting an int to a string
+// returns the rune rather than the formatted number.
+func convertArg(arg reflect.Value, paramType reflect.Type) (reflect.Value, bool) {
+	if arg.Type().AssignableTo(paramType) {
+		return arg, true
+	}
+
+	if !arg.Type().ConvertibleTo(paramType) {
+		return arg, false
+	}
+
+	// Floats aren't converted to integers since the fraction would be lost
+	argType, param := genericType(arg), genericType(reflect.Zero(paramType))
+	if argType != coreInvalid && param != coreInvalid && (argType != coreFloat || param == coreFloat) {
+		return arg.Convert(paramType), true
+	}
+
+	if arg.Kind() == reflect.String && paramType.Kind() == reflect.String {
+		return arg.Convert(paramType), true
+	}
+
+	return arg, false
+}
+
+// jsonField returns the exported field of t whose json tag has the given name.
+// Fields without a json tag use their field name, like encoding/json.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tagName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tagName == "-" {
+			continue
+		}
+
+		if tagName == "" {
+			tagName = field.Name
+		}
+
+		if tagName == name {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// checkContext panics with the context's error if it has been canceled, which
+// is returned by ExecuteContext.
+func checkContext(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		panic(err)
+	}
+}
+
+// blockScope returns the variables that should be used when evaluating the
+// given block, and whether they were copied. Blocks that assign variables get
+// their own copy so new variables don't leak out of the block they were made
+// in.
+func blockScope(n *parser.Node, vars map[string]any) (map[string]any, bool) {
+	for _, child := range n.Children {
+		if child.Kind != parser.KindStatement || len(child.Children) == 0 || child.Children[0] == nil {
+			continue
+		}
+
+		if kind := child.Children[0].Kind; kind == parser.KindAssign || kind == parser.KindCapture {
+			scoped := make(map[string]any, len(vars)+1)
+			for k, v := range vars {
+				scoped[k] = v
+			}
+
+			return scoped, true
+		}
+	}
+
+	return vars, false
+}
+
+// writeBack copies variables that already exist in outer from the scope of a
+// block, so reassigning them in the block updates the enclosing scope. Names
+// bound by the block itself, like range variables, are skipped since they
+// shadow the outer variables.
+func writeBack(outer map[string]any, inner map[string]any, bound ...string) {
+outer:
+	for k := range outer {
+		for _, name := range bound {
+			if k == name {
+				continue outer
+			}
+		}
+
+		outer[k] = inner[k]
+	}
+}
+
 func (t *Template) panicWithTrace(n *parser.Node, msg string) {
 	lines := strings.Split(t.raw, "\n")
 
@@ -467,9 +1325,28 @@ func (t *Template) panicWithTrace(n *parser.Node, msg string) {
 	}
 	relevantLines := lines[n.StartLine-1 : endLine]
 
-	errorMessage := fmt.Sprintf("%s in `%s` starting on line %d:\n%s", msg, t.Name(), n.StartLine, strings.Join(relevantLines, "\n"))
+	panic(&ExecutionError{
+		Template: t.Name(),
+		Line:     n.StartLine,
+		Message:  msg,
+		Source:   strings.Join(relevantLines, "\n"),
+	})
+}
+
+// ExecutionError is returned when a template fails to execute.
+type ExecutionError struct {
+	// Template is the name of the template that failed to execute.
+	Template string
+	// Line is the line the error started on.
+	Line int
+	// Message describes what went wrong.
+	Message string
+	// Source is the template source that caused the error.
+	Source string
+}
 
-	panic(errorMessage)
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("%s in `%s` starting on line %d:\n%s", e.Message, e.Template, e.Line, e.Source)
 }
 
 // TODO this needs to check for the stringer interface, and maybe handle values
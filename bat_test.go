@@ -2,6 +2,8 @@ package bat
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -21,6 +23,208 @@ func TestTemplate(t *testing.T) {
 	require.Equal(t, "<h1>Hello Fox Mulder</h1>", b.String())
 }
 
+func TestTemplate_ExecuteString(t *testing.T) {
+	template, err := NewTemplate("hello.html", "<h1>Hello {{name}}</h1>")
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"name": "Fox Mulder"})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello Fox Mulder</h1>", out)
+
+	// buffers are reused, so make sure output doesn't leak between calls
+	out, err = template.ExecuteString(nil, map[string]any{"name": "Dana Scully"})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello Dana Scully</h1>", out)
+
+	template, err = NewTemplate("hello.html", "<h1>Hello {{greet(name)}}</h1>")
+	require.NoError(t, err)
+
+	out, err = template.ExecuteString(nil, map[string]any{"name": "Fox Mulder"})
+	require.ErrorContains(t, err, "function 'greet' not defined")
+	require.Equal(t, "", out)
+}
+
+func TestTemplate_ExecuteContext(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $name in people}}{{$name}}{{stop($i)}} {{end}}`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	helpers := map[string]any{
+		"stop": func(i int) string {
+			if i == 1 {
+				cancel()
+			}
+			return ""
+		},
+	}
+
+	b := new(bytes.Buffer)
+	err = template.ExecuteContext(ctx, b, helpers, map[string]any{"people": []string{"Fox", "Dana", "Walter"}})
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.Equal(t, "Fox Dana ", b.String())
+}
+
+func TestTemplate_ExecuteContext_Canceled(t *testing.T) {
+	template, err := NewTemplate("hello.html", `Hello {{greet(name)}}`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	helpers := map[string]any{"greet": func(s string) string {
+		called = true
+		return s
+	}}
+
+	b := new(bytes.Buffer)
+	err = template.ExecuteContext(ctx, b, helpers, map[string]any{"name": "Fox"})
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, called)
+}
+
+func TestTemplate_CallWithNil(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ describe(nil) }} {{ describe(missing) }} {{ join(", ", "Fox", nil) }}`, WithEscapeFunc(NoEscape))
+	require.NoError(t, err)
+
+	helpers := map[string]any{
+		"describe": func(v any) string {
+			return fmt.Sprintf("%v", v)
+		},
+		"join": func(sep string, values ...any) string {
+			return fmt.Sprint(len(values))
+		},
+	}
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, helpers, map[string]any{})
+	require.NoError(t, err)
+
+	require.Equal(t, "<nil> <nil> 2", b.String())
+}
+
+func TestTemplate_HelperPanicFallback(t *testing.T) {
+	fallback := func(name string, err any) any {
+		return fmt.Sprintf("[%s failed: %s]", name, err)
+	}
+
+	template, err := NewTemplate("hello.html", `{{ explode() }} {{ name }}`, WithHelperPanicFallback(fallback), WithEscapeFunc(NoEscape))
+	require.NoError(t, err)
+
+	helpers := map[string]any{
+		"explode": func() string {
+			panic("boom")
+		},
+	}
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, helpers, map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+
+	require.Equal(t, "[explode failed: boom] Fox", b.String())
+}
+
+func TestTemplate_HelperPanicWithoutFallback(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ explode() }} {{ name }}`)
+	require.NoError(t, err)
+
+	helpers := map[string]any{
+		"explode": func() string {
+			panic("boom")
+		},
+	}
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, helpers, map[string]any{"name": "Fox"})
+	require.ErrorContains(t, err, "error calling function 'explode': boom")
+}
+
+func TestTemplate_StrictMode(t *testing.T) {
+	template, err := NewTemplate("hello.html", "<h1>Hello\n{{ name }}</h1>", WithStrictMode())
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"name": nil})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello\n</h1>", out)
+
+	_, err = template.ExecuteString(nil, map[string]any{})
+	require.ErrorContains(t, err, "undefined variable 'name' in `hello.html` starting on line 2")
+
+	template, err = NewTemplate("hello.html", `{{ greet("Fox") }}`, WithStrictMode())
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(nil, map[string]any{})
+	require.ErrorContains(t, err, "function 'greet' not defined")
+
+	out, err = template.ExecuteString(map[string]any{"greet": func(s string) string { return "Hi " + s }}, map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, "Hi Fox", out)
+}
+
+func TestTemplate_FallbackValue(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ name }} {{ $missing }}{{ greet(name) }}`, WithFallbackValue("N/A"))
+	require.NoError(t, err)
+
+	helpers := map[string]any{"greet": func(s string) string { return "!" + s }}
+
+	out, err := template.ExecuteString(helpers, map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, "N/A !N/A", out)
+
+	out, err = template.ExecuteString(helpers, map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "Fox !Fox", out)
+}
+
+func TestTemplate_StrictModeAndFallbackValue(t *testing.T) {
+	_, err := NewTemplate("hello.html", `{{ name }}`, WithStrictMode(), WithFallbackValue(""))
+	require.EqualError(t, err, "could not create template: WithStrictMode and WithFallbackValue can't be used together")
+}
+
+func TestTemplate_Delimiters(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ raw }} <% name %><% if name %>!<% end %>`, WithDelimiters("<%", "%>"))
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "{{ raw }} Fox!", out)
+}
+
+func TestTemplate_InvalidDelimiters(t *testing.T) {
+	_, err := NewTemplate("hello.html", `hi`, WithDelimiters("<", ">>"))
+	require.EqualError(t, err, `could not create template: delimiters "<" and ">>" must be at least two characters`)
+
+	_, err = NewTemplate("hello.html", `hi`, WithDelimiters("<<", "<<"))
+	require.EqualError(t, err, `could not create template: delimiters "<<" and "<<" can't contain each other`)
+
+	_, err = NewTemplate("hello.html", `hi`, WithDelimiters("[[[", "[["))
+	require.EqualError(t, err, `could not create template: delimiters "[[[" and "[[" can't contain each other`)
+}
+
+func TestMustNewTemplate(t *testing.T) {
+	template := MustNewTemplate("hello.html", "<h1>Hello {{name}}</h1>")
+
+	b := new(bytes.Buffer)
+	err := template.Execute(b, nil, map[string]any{"name": "Fox Mulder"})
+	require.NoError(t, err)
+
+	require.Equal(t, "<h1>Hello Fox Mulder</h1>", b.String())
+}
+
+func TestMustNewTemplate_Panics(t *testing.T) {
+	defer func() {
+		r := recover()
+		require.NotNil(t, r)
+		require.Contains(t, r, "hello.html")
+		require.Contains(t, r, "unexpected `end`")
+	}()
+
+	MustNewTemplate("hello.html", "<h1>Hello {{end}}</h1>")
+}
+
 type user struct {
 	Name name
 }
@@ -375,6 +579,53 @@ func TestTemplate_Modulo(t *testing.T) {
 	require.Equal(t, expected, b.String())
 }
 
+func TestTemplate_Bitwise(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"and":         {template: `{{ flags & 0b0100 }}`, expected: "4"},
+		"xor":         {template: `{{ flags ^ 0b0001 }}`, expected: "7"},
+		"left shift":  {template: `{{ 1 << 4 }}`, expected: "16"},
+		"right shift": {template: `{{ 0xFF >> 4 }}`, expected: "15"},
+		"uint":        {template: `{{ mask & 0x0F }}`, expected: "10"},
+		"condition":   {template: `{{ if flags & 2 }}yes{{ end }}`, expected: "yes"},
+	}
+
+	data := map[string]any{"flags": 6, "mask": uint8(0xFA)}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_Bitwise_Or(t *testing.T) {
+	_, err := NewTemplate("hello.html", `{{ flags | 2 }}`)
+	require.ErrorContains(t, err, "expected function after `|`, got int, use bitor for bitwise or")
+}
+
+func TestTemplate_Bitwise_NonInteger(t *testing.T) {
+	template, err := NewTemplate("hello.html", "\n{{ name & 1 }}")
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(nil, map[string]any{"name": "Fox"})
+	require.ErrorContains(t, err, "can't use & on string and int, both must be integers in `hello.html` starting on line 2")
+
+	template, err = NewTemplate("hello.html", `{{ 1 << -1 }}`)
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(nil, map[string]any{})
+	require.ErrorContains(t, err, "can't shift by negative amount -1")
+}
+
 func TestTemplate_Escape(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{userInput}}`, WithEscapeFunc(HTMLEscape))
 
@@ -448,6 +699,67 @@ func TestTemplate_CallArgs(t *testing.T) {
 	require.Equal(t, expected, b.String())
 }
 
+func TestTemplate_CallVariadic(t *testing.T) {
+	helpers := map[string]any{
+		"join": func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"sum": func(nums ...int64) int64 {
+			var total int64
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		},
+	}
+
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"zero args":      {template: `[{{ join(", ") }}]`, expected: "[]"},
+		"one arg":        {template: `[{{ join(", ", "a") }}]`, expected: "[a]"},
+		"many args":      {template: `[{{ join(", ", "a", "b", "c") }}]`, expected: "[a, b, c]"},
+		"converted args": {template: `{{ sum(1, 2, 3) }}`, expected: "6"},
+		"safe args":      {template: `{{ join("", safe("a"), "b") }}`, expected: "ab"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithHelpers(helpers))
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(map[string]any{"safe": func(s string) Safe { return Safe(s) }}, nil)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_CallVariadicErrors(t *testing.T) {
+	helpers := map[string]any{
+		"join": func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+	}
+
+	testCases := map[string]struct {
+		template string
+		err      string
+	}{
+		"wrong type":    {template: `{{ join(", ", "a", 1) }}`, err: "argument 3 to function 'join' must be string, got int"},
+		"too few args":  {template: `{{ join() }}`, err: "function 'join' expects at least 1 arguments, got 0"},
+		"float for int": {template: `{{ repeat("a", count) }}`, err: "argument 2 to function 'repeat' must be int, got float64"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithHelpers(helpers))
+			require.NoError(t, err)
+
+			_, err = template.ExecuteString(map[string]any{"repeat": strings.Repeat}, map[string]any{"count": 1.5})
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
 func TestTemplate_CallChain(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{user.Name.Initials()}}`, WithEscapeFunc(HTMLEscape))
 
@@ -461,6 +773,39 @@ func TestTemplate_CallChain(t *testing.T) {
 	require.Equal(t, expected, b.String())
 }
 
+func TestTemplate_HelperResultAccess(t *testing.T) {
+	helpers := map[string]any{
+		"currentUser": func() user { return user{Name: name{First: "Fox", Last: "Mulder"}} },
+		"partner":     func() *user { return &user{Name: name{First: "Dana", Last: "Scully"}} },
+		"nobody":      func() *user { return nil },
+		"settings":    func() map[string]any { return map[string]any{"theme": "dark"} },
+	}
+
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"field":         {template: `{{ currentUser().Name.First }}`, expected: "Fox"},
+		"pointer field": {template: `{{ partner().Name.Last }}`, expected: "Scully"},
+		"method":        {template: `{{ currentUser().GetName().Initials() }}`, expected: "FM"},
+		"map result":    {template: `{{ settings()["theme"] }} {{ settings().theme }}`, expected: "dark dark"},
+		"optional nil":  {template: `[{{ nobody()?.Name.First }}]`, expected: "[]"},
+		"condition":     {template: `{{ if partner().Name.First == "Dana" }}yes{{ end }}`, expected: "yes"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithHelpers(helpers))
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, map[string]any{})
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
 func TestTemplate_CallNestedChain(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{user.GetName().Initials()}}`, WithEscapeFunc(HTMLEscape))
 
@@ -516,6 +861,62 @@ func TestTemplate_BracketAccess(t *testing.T) {
 	require.Equal(t, expected, b.String())
 }
 
+func TestTemplate_BracketAccess_Index(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"first":        {template: `{{ items[0] }}`, expected: "a"},
+		"last":         {template: `{{ items[-1] }}`, expected: "c"},
+		"negative":     {template: `{{ items[-3] }}`, expected: "a"},
+		"uint":         {template: `{{ items[index] }}`, expected: "b"},
+		"array":        {template: `{{ letters[-2] }}`, expected: "y"},
+		"list literal": {template: `{{ [1, 2, 3][-1] }}`, expected: "3"},
+	}
+
+	data := map[string]any{
+		"items":   []string{"a", "b", "c"},
+		"letters": [3]string{"x", "y", "z"},
+		"index":   uint8(1),
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestTemplate_BracketAccess_OutOfRange(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"past end":       {template: "<p>\n{{ items[3] }}</p>", expected: "index 3 out of range with length 3"},
+		"before start":   {template: "<p>\n{{ items[-4] }}</p>", expected: "index -4 out of range with length 3"},
+		"not an integer": {template: "<p>\n{{ items[\"a\"] }}</p>", expected: "can't index slice with string"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, map[string]any{"items": []string{"a", "b", "c"}})
+			require.ErrorContains(t, err, tc.expected)
+			require.ErrorContains(t, err, "starting on line 2")
+		})
+	}
+}
+
 func TestTemplate_Nil(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{ value }}`)
 	require.NoError(t, err)
@@ -712,6 +1113,38 @@ func TestTemplate_VarGreaterThanEqual(t *testing.T) {
 	require.Equal(t, expected, b.String())
 }
 
+func TestTemplate_StringComparison(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"less than":                 {template: `{{ a.Name < b.Name }}`, expected: "true"},
+		"greater than":              {template: `{{ a.Name > b.Name }}`, expected: "false"},
+		"less than or equal":        {template: `{{ a.Name <= "Dana" }}`, expected: "true"},
+		"greater than or equal":     {template: `{{ b.Name >= "Fox" }}`, expected: "true"},
+		"not greater than or equal": {template: `{{ a.Name >= b.Name }}`, expected: "false"},
+	}
+
+	data := map[string]any{"a": map[string]any{"Name": "Dana"}, "b": map[string]any{"Name": "Fox"}}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, data)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	template, err := NewTemplate("hello.html", "<p>\n{{ if a.Name < 1 }}{{ end }}</p>")
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(nil, data)
+	require.EqualError(t, err, "can't compare type string and int in `hello.html` starting on line 2:\n{{ if a.Name < 1 }}{{ end }}</p>")
+}
+
 func TestTemplate_VarLessThanEqual(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{ if Page <= 1}}foo{{end}}`)
 	require.NoError(t, err)
@@ -741,6 +1174,76 @@ func TestTemplate_MathOrder(t *testing.T) {
 	require.Equal(t, expected, b.String())
 }
 
+func TestTemplate_MixedTypeMath(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"int and float":   {template: `{{ count * price }}`, expected: "3"},
+		"float and int":   {template: `{{ price * count }}`, expected: "3"},
+		"float minus int": {template: `{{ price - count }}`, expected: "-0.5"},
+		"int minus float": {template: `{{ count - price }}`, expected: "0.5"},
+		"float plus int":  {template: `{{ price + count }}`, expected: "3.5"},
+		"float div int":   {template: `{{ price / count }}`, expected: "0.75"},
+		"float mod int":   {template: `{{ price % count }}`, expected: "1.5"},
+		"float32 and int": {template: `{{ small * count }}`, expected: "5"},
+		"float32 mod int": {template: `{{ small % count }}`, expected: "0.5"},
+		"int and int64":   {template: `{{ count + id }}`, expected: "3"},
+		"same types":      {template: `{{ price + price }}`, expected: "3"},
+		"safe and string": {template: `{{ safe("<b>") + "<i>" }}`, expected: "<b>&lt;i&gt;"},
+	}
+
+	helpers := map[string]any{"safe": func(s string) Safe { return Safe(s) }}
+	data := map[string]any{"count": 2, "price": 1.5, "small": float32(2.5), "id": int64(1)}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(helpers, data)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_StrictArithmetic(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+		err      string
+	}{
+		"int and float":   {template: `{{ count * price }}`, err: "mismatched types int and float64"},
+		"float and int":   {template: `{{ price - count }}`, err: "mismatched types float64 and int"},
+		"int and int64":   {template: `{{ count + id }}`, err: "mismatched types int and int64"},
+		"division":        {template: `{{ id / count }}`, err: "mismatched types int64 and int"},
+		"modulo":          {template: `{{ id % count }}`, err: "mismatched types int64 and int"},
+		"same types":      {template: `{{ price + price }}`, expected: "3"},
+		"literals":        {template: `{{ count * 2 }}`, expected: "4"},
+		"safe and string": {template: `{{ safe("<b>") + "<i>" }}`, expected: "<b>&lt;i&gt;"},
+	}
+
+	helpers := map[string]any{"safe": func(s string) Safe { return Safe(s) }}
+	data := map[string]any{"count": 2, "price": 1.5, "id": int64(1)}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithStrictArithmetic())
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(helpers, data)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
 func TestTemplate_MissingHelper(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{len(foo)}}`)
 	require.NoError(t, err)
@@ -772,6 +1275,16 @@ func TestTemplate_MissingMapAccessValue(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestTemplate_MissingMapPropertyValue(t *testing.T) {
+	template, err := NewTemplate("hello.html", `a{{ Foo.bar }}b`)
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"Foo": map[string]string{}})
+	require.NoError(t, err)
+
+	require.Equal(t, "ab", out)
+}
+
 func TestTemplate_MapAccessInMap(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{ { Errors: Errors["first"] } }}`)
 	require.NoError(t, err)
@@ -816,6 +1329,44 @@ func TestTemplate_MapAccessInMap_WrongTypes(t *testing.T) {
 	require.ErrorContains(t, err, "cannot access map of type map[string]string with access of type int")
 }
 
+func TestTemplate_MapExpressionValues(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"call":        {template: `{{ {count: len(items)}["count"] }}`, expected: "2"},
+		"infix":       {template: `{{ {label: "Items: " + title}["label"] }}`, expected: "Items: Agents"},
+		"math":        {template: `{{ {total: len(items) * 2}["total"] }}`, expected: "4"},
+		"nested map":  {template: `{{ {user: {name: name}}["user"]["name"] }}`, expected: "Fox"},
+		"nested end":  {template: `{{$m = {user: {name: name}}}}{{ $m["user"]["name"] }}`, expected: "Fox"},
+		"bracket":     {template: `{{ {first: items[0]}["first"] }}`, expected: "Mulder"},
+		"list":        {template: `{{ {names: [name, "Dana"]}["names"][1] }}`, expected: "Dana"},
+		"method call": {template: `{{ {initials: user.Name.Initials()}["initials"] }}`, expected: "FM"},
+		"keyword key": {template: `{{ {if: true, end: name}["end"] }}`, expected: "Fox"},
+		"string key":  {template: `{{ {"data-id": name}["data-id"] }}`, expected: "Fox"},
+	}
+
+	data := map[string]any{
+		"items": []string{"Mulder", "Scully"},
+		"title": "Agents",
+		"name":  "Fox",
+		"user":  user{Name: name{First: "Fox", Last: "Mulder"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithHelpers(map[string]any{"len": func(v any) int { return reflect.ValueOf(v).Len() }}))
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
 func TestTemplate_StringConcat(t *testing.T) {
 	template, err := NewTemplate("hello.html", `{{ "Hello, " + Name }}`)
 	require.NoError(t, err)
@@ -867,3 +1418,1176 @@ func TestInt64_Equal(t *testing.T) {
 
 	require.Equal(t, `true`, b.String())
 }
+
+type timelineEvent struct {
+	Day   string
+	Title string
+}
+
+func TestTemplateRange_LoopPrevNext(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $event in events}}{{if $loop.Prev == nil}}<h2>{{$event.Day}}</h2>{{else}}{{if $loop.Prev.Day != $event.Day}}<h2>{{$event.Day}}</h2>{{end}}{{end}}<p>{{$event.Title}}</p>{{end}}`)
+	require.NoError(t, err)
+
+	data := map[string]any{
+		"events": []timelineEvent{
+			{Day: "Monday", Title: "Pilot"},
+			{Day: "Monday", Title: "Deep Throat"},
+			{Day: "Tuesday", Title: "Squeeze"},
+		},
+	}
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, data)
+	require.NoError(t, err)
+
+	expected := `<h2>Monday</h2><p>Pilot</p><p>Deep Throat</p><h2>Tuesday</h2><p>Squeeze</p>`
+	require.Equal(t, expected, b.String())
+}
+
+func TestTemplateRange_LoopNext(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $name in people}}{{$name}}{{if $loop.Next != nil}}, {{end}}{{end}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"people": []string{"Fox", "Dana", "Walter"}})
+	require.NoError(t, err)
+
+	require.Equal(t, "Fox, Dana, Walter", b.String())
+}
+
+func TestTemplateRange_LoopPrevNextBoundaries(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $name in people}}[{{$loop.Prev}}<{{$name}}>{{$loop.Next}}]{{end}}`)
+	require.NoError(t, err)
+
+	testCases := map[string]any{
+		"slice": []string{"Fox", "Dana", "Walter"},
+		"array": [3]string{"Fox", "Dana", "Walter"},
+	}
+
+	for name, people := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, map[string]any{"people": people})
+			require.NoError(t, err)
+
+			require.Equal(t, "[<Fox>Dana][Fox<Dana>Walter][Dana<Walter>]", b.String())
+		})
+	}
+}
+
+func TestTemplateRange_LoopPrevChannel(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $name in people}}[{{$loop.Prev}}<{{$name}}>{{$loop.Next}}]{{end}}`)
+	require.NoError(t, err)
+
+	people := make(chan string, 3)
+	people <- "Fox"
+	people <- "Dana"
+	people <- "Walter"
+	close(people)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"people": people})
+	require.NoError(t, err)
+
+	require.Equal(t, "[<Fox>][Fox<Dana>][Dana<Walter>]", b.String())
+}
+
+func TestTemplateRange_Limit(t *testing.T) {
+	testCases := map[string]struct {
+		limit     int
+		expected  string
+		remaining int
+	}{
+		"smaller": {limit: 2, expected: "<Fox><Dana>", remaining: 1},
+		"larger":  {limit: 5, expected: "<Fox><Dana><Walter>", remaining: 0},
+		"zero":    {limit: 0, expected: "none", remaining: 3},
+	}
+
+	template, err := NewTemplate("hello.html", `{{range $i, $name in people limit max}}<{{$name}}>{{else}}none{{end}}`)
+	require.NoError(t, err)
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := template.ExecuteString(nil, map[string]any{"people": []string{"Fox", "Dana", "Walter"}, "max": tc.limit})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+
+		t.Run(name+" channel", func(t *testing.T) {
+			people := make(chan string, 3)
+			people <- "Fox"
+			people <- "Dana"
+			people <- "Walter"
+			close(people)
+
+			out, err := template.ExecuteString(nil, map[string]any{"people": people, "max": tc.limit})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+
+			// Values after the limit aren't received
+			require.Len(t, people, tc.remaining)
+		})
+	}
+}
+
+func TestTemplateRange_LimitLoopNext(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $name in people limit 2}}{{$name}}{{if $loop.Next}}, {{end}}{{end}}`)
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"people": []string{"Fox", "Dana", "Walter"}})
+	require.NoError(t, err)
+	require.Equal(t, "Fox, Dana", out)
+}
+
+func TestTemplateRange_LimitMapAndInts(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $k, $v in scores limit 2}}{{$k}}={{$v}} {{end}}{{range $i in 1..10 limit 3}}{{$i}}{{end}}`)
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"scores": map[string]int{"c": 3, "a": 1, "b": 2}})
+	require.NoError(t, err)
+	require.Equal(t, "a=1 b=2 123", out)
+}
+
+func TestTemplateRange_LimitErrors(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $v in items limit max}}{{$v}}{{end}}`)
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(nil, map[string]any{"items": []int{1}, "max": "2"})
+	require.ErrorContains(t, err, "range limit must be an integer, got string")
+
+	_, err = template.ExecuteString(nil, map[string]any{"items": []int{1}, "max": -1})
+	require.ErrorContains(t, err, "range limit must not be negative, got -1")
+}
+
+func TestTemplate_Assignment(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ $name = user.Name }}{{ $name.First }} {{ $name.Last }} ({{ $name.Initials() }})`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"user": user{Name: name{First: "Fox", Last: "Mulder"}}})
+	require.NoError(t, err)
+
+	require.Equal(t, "Fox Mulder (FM)", b.String())
+}
+
+func TestTemplate_Reassignment(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ $name = "Fox" }}{{ $name }} {{ $name = "Dana" }}{{ $name }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{})
+	require.NoError(t, err)
+
+	require.Equal(t, "Fox Dana", b.String())
+}
+
+func TestTemplate_AssignmentScope(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"reassign in if":      {template: `{{ $x = 1 }}{{if true}}{{ $x = 2 }}{{ $x }}{{end}}{{ $x }}`, expected: "22"},
+		"new in if":           {template: `{{if true}}{{ $x = 2 }}{{ $x }}{{end}}[{{ $x }}]`, expected: "2[]"},
+		"accumulator":         {template: `{{ $t = 0 }}{{range $i, $v in items}}{{ $t = $t + $v }}{{end}}{{ $t }}`, expected: "6"},
+		"new in range":        {template: `{{range $i, $v in items}}{{ $last = $v }}{{end}}[{{ $last }}]`, expected: "[]"},
+		"nested":              {template: `{{ $t = 0 }}{{range $i, $v in items}}{{if $v > 1}}{{ $t = $t + $v }}{{end}}{{end}}{{ $t }}`, expected: "5"},
+		"range var shadows":   {template: `{{ $v = "outer" }}{{range $i, $v in items}}{{ $v = 0 }}{{end}}{{ $v }}`, expected: "outer"},
+		"with":                {template: `{{ $n = 0 }}{{with items}}{{ $n = len(.) }}{{end}}{{ $n }}`, expected: "3"},
+		"reassign range var":  {template: `{{ $title = "Agent" }}{{range $i, $name in people}}{{ $name = $title + " " + $name }}{{ $name }}, {{end}}`, expected: "Agent Mulder, Agent Scully, "},
+		"reassign after else": {template: `{{ $x = 1 }}{{if false}}{{ $x = 2 }}{{else}}{{ $x = 3 }}{{end}}{{ $x }}`, expected: "3"},
+	}
+
+	helpers := map[string]any{"len": func(v []int) int { return len(v) }}
+	data := map[string]any{"items": []int{1, 2, 3}, "people": []string{"Mulder", "Scully"}}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(helpers, data)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_LetAssignment(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ let $total = a + b }}{{ $total }} {{range $i in 0..2}}{{ let $total = $total + $i }}{{ $total }} {{end}}{{ let $total = $total * 2 }}{{ $total }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"a": 1, "b": 2})
+	require.NoError(t, err)
+
+	require.Equal(t, "3 3 4 8", b.String())
+}
+
+type taggedUser struct {
+	tags []string
+}
+
+func (u taggedUser) Tags() []string {
+	return u.tags
+}
+
+func TestTemplateRange_MethodCall(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $tag in user.Tags()}}{{$i}}:{{$tag}} {{end}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"user": taggedUser{tags: []string{"agent", "fbi"}}})
+	require.NoError(t, err)
+
+	require.Equal(t, "0:agent 1:fbi ", b.String())
+}
+
+type point struct {
+	x, y float64
+}
+
+func (p point) Coords() [2]float64 {
+	return [2]float64{p.x, p.y}
+}
+
+func TestTemplate_IndexMethodArray(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ point.Coords()[0] }},{{ point.Coords()[1] }} {{ point.Coords()[i] }}`)
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"point": point{x: 1.5, y: -2}, "i": 1})
+	require.NoError(t, err)
+	require.Equal(t, "1.5,-2 -2", out)
+
+	_, err = template.ExecuteString(nil, map[string]any{"point": point{x: 1.5, y: -2}, "i": 2})
+	require.ErrorContains(t, err, "index 2 out of range with length 2")
+}
+
+func TestTemplate_HashStringKeys(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ {"data-id": 1, foo: 2}["data-id"] }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{})
+	require.NoError(t, err)
+
+	require.Equal(t, "1", b.String())
+}
+
+func TestTemplate_HashComputedKeys(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ {(key): value, (1): "one"} }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"key": "agent", "value": "Mulder"})
+	require.NoError(t, err)
+
+	require.Equal(t, "map[1:one agent:Mulder]", b.String())
+}
+
+func TestTemplateRange_Else(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $name in people}}{{$name}} {{else}}No people{{end}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"people": []string{"Fox", "Dana"}})
+	require.NoError(t, err)
+	require.Equal(t, "Fox Dana ", b.String())
+
+	b = new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"people": []string{}})
+	require.NoError(t, err)
+	require.Equal(t, "No people", b.String())
+
+	b = new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, "No people", b.String())
+}
+
+func TestTemplateRange_ElseEmptyCollections(t *testing.T) {
+	testCases := map[string]any{
+		"slice": []string{},
+		"array": [0]string{},
+		"map":   map[string]string{},
+		"nil":   nil,
+	}
+
+	for name, people := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", `{{ range $name in people }}{{$name}}{{ else }}No people{{ end }}`)
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, map[string]any{"people": people})
+			require.NoError(t, err)
+			require.Equal(t, "No people", b.String())
+		})
+	}
+}
+
+func TestTemplateRange_ElseNotRenderedForMap(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ range $k, $v in people }}{{$k}}={{$v}}{{ else }}No people{{ end }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"people": map[string]string{"Fox": "Mulder"}})
+	require.NoError(t, err)
+	require.Equal(t, "Fox=Mulder", b.String())
+}
+
+func TestTemplateRange_ElseChannel(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $name in people}}{{$name}}{{else}}No people{{end}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"people": make(chan string)})
+	require.NoError(t, err)
+	require.Equal(t, "No people", b.String())
+}
+
+func TestTemplateRange_Ints(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"ascending":     {template: `{{range $i in 1..count}}{{$i}} {{end}}`, expected: "1 2 3 "},
+		"descending":    {template: `{{range $i in count..0}}{{$i}} {{end}}`, expected: "4 3 2 1 "},
+		"empty":         {template: `{{range $i in 5..5}}{{$i}}{{else}}empty{{end}}`, expected: "empty"},
+		"two variables": {template: `{{range $i, $v in 2..count}}{{$i}}:{{$v}} {{end}}`, expected: "0:2 1:3 "},
+		"loop":          {template: `{{range $i in count..1}}{{$loop.Prev}}<{{$i}}>{{$loop.Next}} {{end}}`, expected: "<4>3 4<3>2 3<2> "},
+		"huge limit":    {template: `{{range $i in 0..1000000000000 limit 3}}{{$i}}{{end}}`, expected: "012"},
+		"huge break":    {template: `{{range $i in 0..1000000000000}}{{if $i == 2}}{{break}}{{end}}{{$i}}{{end}}`, expected: "01"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, map[string]any{"count": 4})
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestTemplateRange_IntsInvalidBound(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i in 1..count}}{{$i}}{{end}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"count": "4"})
+	require.ErrorContains(t, err, "range bounds must be integers, got string")
+}
+
+func TestTemplateRange_Break(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"slice":   {template: `{{range $i, $v in items}}{{if $i == 2}}{{break}}{{end}}{{$v}} {{end}}`, data: map[string]any{"items": []string{"a", "b", "c", "d"}}, expected: "a b "},
+		"map":     {template: `{{range $k, $v in items}}{{if $k == "b"}}{{break}}{{end}}{{$v}} {{end}}`, data: map[string]any{"items": map[string]int{"a": 1, "b": 2, "c": 3}}, expected: "1 "},
+		"ints":    {template: `{{range $i in 0..10}}{{$i}} {{if $i == 1}}{{break}}{{end}}{{end}}`, data: map[string]any{}, expected: "0 1 "},
+		"nested":  {template: `{{range $i in 0..2}}{{range $j in 0..3}}{{if $j == 1}}{{break}}{{end}}{{$i}}{{$j}} {{end}}{{end}}`, data: map[string]any{}, expected: "00 10 "},
+		"in else": {template: `{{range $i in 0..3}}{{if $i == 1}}{{break}}{{else}}{{$i}} {{end}}{{end}}`, data: map[string]any{}, expected: "0 "},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestTemplateRange_BreakChannel(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $i, $v in items}}{{$v}} {{break}}{{end}}`)
+	require.NoError(t, err)
+
+	items := make(chan string, 2)
+	items <- "Fox"
+	items <- "Dana"
+	close(items)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"items": items})
+	require.NoError(t, err)
+
+	require.Equal(t, "Fox ", b.String())
+}
+
+func TestTemplateRange_Continue(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"slice":         {template: `{{range $i, $v in items}}<{{if $i == 1}}{{continue}}{{end}}{{$v}}>{{end}}`, data: map[string]any{"items": []string{"a", "b", "c"}}, expected: "<a><<c>"},
+		"map":           {template: `{{range $k, $v in items}}{{if $k == "b"}}{{continue}}{{end}}{{$v}} {{end}}`, data: map[string]any{"items": map[string]int{"a": 1, "b": 2, "c": 3}}, expected: "1 3 "},
+		"ints":          {template: `{{range $i in 0..4}}{{if $i < 2}}{{continue}}{{end}}{{$i}} {{end}}`, data: map[string]any{}, expected: "2 3 "},
+		"nested":        {template: `{{range $i in 0..2}}{{range $j in 0..3}}{{if $j == 1}}{{continue}}{{end}}{{$i}}{{$j}} {{end}}{{end}}`, data: map[string]any{}, expected: "00 02 10 12 "},
+		"nested if":     {template: `{{range $i in 0..3}}{{if $i > 0}}{{if $i == 1}}{{continue}}{{end}}{{end}}{{$i}} {{end}}`, data: map[string]any{}, expected: "0 2 "},
+		"with else":     {template: `{{range $i in 0..3}}{{if $i != 1}}{{$i}} {{else}}{{continue}}{{end}}!{{end}}`, data: map[string]any{}, expected: "0 !2 !"},
+		"then break":    {template: `{{range $i in 0..5}}{{if $i == 1}}{{continue}}{{end}}{{if $i == 3}}{{break}}{{end}}{{$i}} {{end}}`, data: map[string]any{}, expected: "0 2 "},
+		"with channels": {template: `{{range $i, $v in items}}{{if $v == "b"}}{{continue}}{{end}}{{$v}} {{end}}`, data: map[string]any{"items": stringChannel("a", "b", "c")}, expected: "a c "},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func stringChannel(values ...string) chan string {
+	c := make(chan string, len(values))
+	for _, v := range values {
+		c <- v
+	}
+	close(c)
+
+	return c
+}
+
+func TestTemplateRange_BreakContinueNested(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ range $_, $row in rows }}{{ if $row.Skip }}{{ continue }}{{ end }}{{ range $_, $x in $row.Items }}{{ if $x == target }}{{ break }}{{ end }}{{ $x }}{{ end }};{{ end }}`)
+	require.NoError(t, err)
+
+	rows := []map[string]any{
+		{"Skip": false, "Items": []string{"a", "b", "stop", "c"}},
+		{"Skip": true, "Items": []string{"d"}},
+		{"Skip": false, "Items": []string{"e", "stop"}},
+	}
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"rows": rows, "target": "stop"})
+	require.NoError(t, err)
+
+	require.Equal(t, "ab;e;", b.String())
+}
+
+func TestTemplate_Slice(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"slice":      {template: `{{range $_, $v in items[1:3]}}{{$v}}{{end}}`, expected: "bc"},
+		"array":      {template: `{{range $_, $v in letters[1:]}}{{$v}}{{end}}`, expected: "yz"},
+		"open low":   {template: `{{range $_, $v in items[:2]}}{{$v}}{{end}}`, expected: "ab"},
+		"open high":  {template: `{{range $_, $v in items[2:]}}{{$v}}{{end}}`, expected: "cd"},
+		"string":     {template: `{{name[0:1]}}.`, expected: "F."},
+		"expression": {template: `{{name[1:len(name) - 1]}}`, expected: "o"},
+		"variable":   {template: `{{$end = 2}}{{len(items[:$end])}}`, expected: "2"},
+		"chained":    {template: `{{items[1:][0]}}`, expected: "b"},
+	}
+
+	data := map[string]any{
+		"items":   []string{"a", "b", "c", "d"},
+		"letters": [3]string{"x", "y", "z"},
+		"name":    "Fox",
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithHelpers(map[string]any{"len": func(v any) int { return reflect.ValueOf(v).Len() }}))
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestTemplate_Slice_Invalid(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{user[0:1]}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"user": map[string]any{}})
+	require.ErrorContains(t, err, "cannot slice map")
+
+	for input, expected := range map[string]string{
+		`{{name[0:4]}}`:  "slice bounds [0:4] out of range with length 3",
+		`{{name[2:1]}}`:  "slice bounds [2:1] out of range with length 3",
+		`{{name[-1:]}}`:  "slice bounds [-1:3] out of range with length 3",
+		`{{items[5:]}}`:  "slice bounds [5:0] out of range with length 0",
+		`{{items[:-1]}}`: "slice bounds [0:-1] out of range with length 0",
+	} {
+		template, err = NewTemplate("hello.html", "\n"+input)
+		require.NoError(t, err)
+
+		err = template.Execute(b, nil, map[string]any{"name": "Fox", "items": []string{}})
+		require.ErrorContains(t, err, expected)
+		require.ErrorContains(t, err, "starting on line 2")
+	}
+
+	template, err = NewTemplate("hello.html", `{{name[0:last]}}`)
+	require.NoError(t, err)
+
+	err = template.Execute(b, nil, map[string]any{"name": "Fox", "last": "1"})
+	require.ErrorContains(t, err, "slice bounds must be integers, got string")
+}
+
+func TestTemplate_InList(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ if status in ["open", "pending"] }}active{{ else }}inactive{{ end }}`)
+	require.NoError(t, err)
+
+	testCases := map[string]string{
+		"open":    "active",
+		"pending": "active",
+		"closed":  "inactive",
+	}
+
+	for status, expected := range testCases {
+		t.Run(status, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, map[string]any{"status": status})
+			require.NoError(t, err)
+
+			require.Equal(t, expected, b.String())
+		})
+	}
+}
+
+func TestTemplate_InMapsAndStrings(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"map key":       {template: `{{ if key in settings }}yes{{ else }}no{{ end }}`, data: map[string]any{"key": "theme", "settings": map[string]any{"theme": "dark"}}, expected: "yes"},
+		"missing key":   {template: `{{ if key in settings }}yes{{ else }}no{{ end }}`, data: map[string]any{"key": "locale", "settings": map[string]any{"theme": "dark"}}, expected: "no"},
+		"substring":     {template: `{{ if "@" in email }}yes{{ else }}no{{ end }}`, data: map[string]any{"email": "fox@fbi.gov"}, expected: "yes"},
+		"no substring":  {template: `{{ if "@" in email }}yes{{ else }}no{{ end }}`, data: map[string]any{"email": "fox"}, expected: "no"},
+		"nil right":     {template: `{{ if role in roles }}yes{{ else }}no{{ end }}`, data: map[string]any{"role": "admin"}, expected: "no"},
+		"output result": {template: `{{ role in ["admin", "owner"] }}`, data: map[string]any{"role": "owner"}, expected: "true"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_ListLiteral(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ range $_, $v in [1, name, [true]] }}{{ $v }},{{ end }}{{ [] }} {{ $id in [1, 2] }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = template.Execute(b, nil, map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+
+	require.Equal(t, "1,Fox,[true],[] false", b.String())
+}
+
+type address struct {
+	City string
+	Zip  string
+}
+
+func TestTemplateRange_Context(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"slice":    {template: `{{range $i in names}}{{$i}}:{{.}} {{end}}`, data: map[string]any{"names": []string{"Fox", "Dana"}}, expected: "0:Fox 1:Dana "},
+		"struct":   {template: `{{range $i in addresses}}{{.City}} {{end}}`, data: map[string]any{"addresses": []address{{City: "Washington"}, {City: "Quantico"}}}, expected: "Washington Quantico "},
+		"map":      {template: `{{range $k in ages}}{{$k}}={{.}} {{end}}`, data: map[string]any{"ages": map[string]int{"Fox": 33, "Dana": 30}}, expected: "Dana=30 Fox=33 "},
+		"integers": {template: `{{range $i in 1..4}}{{.}}{{end}}`, data: map[string]any{}, expected: "123"},
+		"with":     {template: `{{range $i in names}}{{with user}}{{.}}{{end}}{{.}}{{end}}`, data: map[string]any{"names": []string{"a"}, "user": "u"}, expected: "ua"},
+		"two vars": {template: `{{range $i, $name in names}}{{.}}{{end}}`, data: map[string]any{"names": []string{"a", "b"}}, expected: "ab"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithEscapeFunc(NoEscape))
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_OptionalAccess(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"present":     {template: `{{user?.Address?.City}}`, data: map[string]any{"user": map[string]any{"Address": address{City: "Washington"}}}, expected: "Washington"},
+		"nil root":    {template: `a{{user?.Address?.City}}b`, data: map[string]any{}, expected: "ab"},
+		"nil middle":  {template: `a{{user?.Address?.City}}b`, data: map[string]any{"user": map[string]any{"Address": nil}}, expected: "ab"},
+		"nil pointer": {template: `a{{address?.City}}b`, data: map[string]any{"address": (*address)(nil)}, expected: "ab"},
+		"propagates":  {template: `a{{user?.Address.City}}b`, data: map[string]any{}, expected: "ab"},
+		"condition":   {template: `{{if user?.Address}}yes{{else}}no{{end}}`, data: map[string]any{}, expected: "no"},
+		"missing key": {template: `a{{order?.Customer?.Address?.City}}b`, data: map[string]any{"order": map[string]any{}}, expected: "ab"},
+		"deep chain":  {template: `{{order?.Customer?.Address?.City}}`, data: map[string]any{"order": map[string]any{"Customer": map[string]any{"Address": &address{City: "Quantico"}}}}, expected: "Quantico"},
+		"nil call":    {template: `a{{n?.Items()}}b`, data: map[string]any{"n": nil}, expected: "ab"},
+		"call":        {template: `{{n?.Items()}}`, data: map[string]any{"n": map[string]any{"Items": func() string { return "items" }}}, expected: "items"},
+		"nil index":   {template: `a{{n?.Tags[0]}}b`, data: map[string]any{"n": nil}, expected: "ab"},
+		"index":       {template: `{{n?.Tags[0]}}`, data: map[string]any{"n": map[string]any{"Tags": []string{"go"}}}, expected: "go"},
+		"nil chain":   {template: `a{{n?.Tags[0].Name}}b`, data: map[string]any{"n": nil}, expected: "ab"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_OptionalAccess_RequiredAccessPanics(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{user.Address?.City}}`)
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(nil, map[string]any{})
+	require.ErrorContains(t, err, "attempted to access property `Address` on nil value")
+}
+
+func TestTemplate_UndefinedMethodName(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{n.Items()}}`)
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(nil, map[string]any{"n": map[string]any{}})
+	require.ErrorContains(t, err, "function 'Items' not defined")
+}
+
+func TestTemplate_Ternary(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"true":          {template: `{{ admin ? "Admin" : "User" }}`, data: map[string]any{"admin": true}, expected: "Admin"},
+		"false":         {template: `{{ admin ? "Admin" : "User" }}`, data: map[string]any{"admin": false}, expected: "User"},
+		"falsy":         {template: `{{ name ? name : "Anonymous" }}`, data: map[string]any{}, expected: "Anonymous"},
+		"comparison":    {template: `{{ count == 1 ? "item" : "items" }}`, data: map[string]any{"count": 2}, expected: "items"},
+		"nested false":  {template: `{{ a ? "a" : b ? "b" : "c" }}`, data: map[string]any{"a": false, "b": true}, expected: "b"},
+		"nested true":   {template: `{{ a ? b ? "ab" : "a" : "none" }}`, data: map[string]any{"a": true, "b": false}, expected: "a"},
+		"map value":     {template: `{{ {label: admin ? "Admin" : "User"}["label"] }}`, data: map[string]any{"admin": true}, expected: "Admin"},
+		"call argument": {template: `{{ len(admin ? "Admin" : "User") }}`, data: map[string]any{"admin": false}, expected: "4"},
+		"mixed int":     {template: `{{ count > 0 ? count : "none" }}`, data: map[string]any{"count": 3}, expected: "3"},
+		"mixed string":  {template: `{{ count > 0 ? count : "none" }}`, data: map[string]any{"count": 0}, expected: "none"},
+		"mixed nil":     {template: `[{{ count > 0 ? count : nil }}]`, data: map[string]any{"count": 0}, expected: "[]"},
+		"mixed types":   {template: `{{ type(count > 0 ? count : "none") }} {{ type(count > 5 ? count : "none") }}`, data: map[string]any{"count": 3}, expected: "int string"},
+	}
+
+	helpers := map[string]any{
+		"len":  func(s string) int { return len(s) },
+		"type": func(v any) string { return fmt.Sprintf("%T", v) },
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(helpers, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_NullCoalesce(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"nil":          {template: `{{ name ?? "Anonymous" }}`, data: map[string]any{}, expected: "Anonymous"},
+		"present":      {template: `{{ name ?? "Anonymous" }}`, data: map[string]any{"name": "Fox"}, expected: "Fox"},
+		"zero int":     {template: `{{ 0 ?? 42 }}`, data: map[string]any{}, expected: "0"},
+		"empty string": {template: `{{ name ?? "Anonymous" }}`, data: map[string]any{"name": ""}, expected: ""},
+		"nil pointer":  {template: `{{ address ?? "none" }}`, data: map[string]any{"address": (*address)(nil)}, expected: "none"},
+		"chained":      {template: `{{ nickname ?? name ?? "Anonymous" }}`, data: map[string]any{"name": "Fox"}, expected: "Fox"},
+		"precedence":   {template: `{{ count + 1 ?? 0 }}`, data: map[string]any{"count": 1}, expected: "2"},
+		"access":       {template: `{{ user?.Name ?? "Anonymous" }}`, data: map[string]any{}, expected: "Anonymous"},
+		"ternary":      {template: `{{ name ?? false ? "named" : "unnamed" }}`, data: map[string]any{}, expected: "unnamed"},
+		"access chain": {
+			template: `{{ user.Nickname ?? user.Name }}`,
+			data:     map[string]any{"user": map[string]any{"Nickname": nil, "Name": "Fox"}},
+			expected: "Fox",
+		},
+		"struct field": {
+			template: `{{ home.City ?? "unknown" }}`,
+			data:     map[string]any{"home": &address{City: "Arlington"}},
+			expected: "Arlington",
+		},
+		"condition": {
+			template: `{{ if admin ?? false }}admin{{ else }}user{{ end }}`,
+			data:     map[string]any{},
+			expected: "user",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_NullCoalesce_OptionalChain(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ nickname ?? fullName ?? "Anonymous" }} {{ a?.b ?? "default" }}`)
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, "Anonymous default", out)
+
+	out, err = template.ExecuteString(nil, map[string]any{"fullName": "Fox Mulder", "a": map[string]any{}})
+	require.NoError(t, err)
+	require.Equal(t, "Fox Mulder default", out)
+
+	out, err = template.ExecuteString(nil, map[string]any{"nickname": "Spooky", "a": map[string]any{"b": "b"}})
+	require.NoError(t, err)
+	require.Equal(t, "Spooky b", out)
+}
+
+func TestTemplate_NullCoalesce_ShortCircuits(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ name ?? fail() }}`)
+	require.NoError(t, err)
+
+	helpers := map[string]any{"fail": func() string { panic("should not be called") }}
+
+	out, err := template.ExecuteString(helpers, map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "Fox", out)
+}
+
+func TestTemplate_KeywordNames(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"block":             {template: `{{ block }}`, expected: "1"},
+		"block access":      {template: `{{ page.block }}`, expected: "2"},
+		"define":            {template: `{{ define }}`, expected: "3"},
+		"define access":     {template: `{{ page?.define }}`, expected: "4"},
+		"if access":         {template: `{{ page.if }}`, expected: "5"},
+		"context":           {template: `{{ with page }}{{ .range }}{{ end }}`, expected: "6"},
+		"switch":            {template: `{{ switch }}`, expected: "7"},
+		"case":              {template: `{{ case }}`, expected: "8"},
+		"case access":       {template: `{{ item.case }}`, expected: "9"},
+		"switch case":       {template: `{{ switch switch }}{{ case 7 }}{{ case }}{{ end }}`, expected: "8"},
+		"slot":              {template: `{{ slot }}`, expected: "10"},
+		"slot access":       {template: `{{ layout.slot }}`, expected: "11"},
+		"yield access":      {template: `{{ layout.yield }}`, expected: "12"},
+		"do":                {template: `{{ do }}`, expected: "13"},
+		"do access":         {template: `{{ x.do }}`, expected: "14"},
+		"capture":           {template: `{{ capture }}`, expected: "15"},
+		"capture access":    {template: `{{ x.capture }}`, expected: "16"},
+		"defined":           {template: `{{ if defined }}{{ defined }}{{ end }}`, expected: "17"},
+		"defined access":    {template: `{{ x.defined }}`, expected: "18"},
+		"defined check":     {template: `{{ if defined defined }}yes{{ end }}`, expected: "yes"},
+		"break":             {template: `{{ break }}`, expected: "25"},
+		"break in range":    {template: `{{ range $i, $v in list }}{{ x.break }}{{ break }}{{ end }}`, expected: "26"},
+		"break access":      {template: `{{ if break }}{{ x.break }}{{ end }}`, expected: "26"},
+		"continue":          {template: `{{ continue }}`, expected: "27"},
+		"continue in range": {template: `{{ range $i, $v in list }}{{ x.continue }}{{ continue }}!{{ end }}`, expected: "2828"},
+		"with":              {template: `{{ with }}`, expected: "23"},
+		"with access":       {template: `{{ x.with }}{{ with x }}{{ .with }}{{ end }}`, expected: "2424"},
+		"let":               {template: `{{ let }}`, expected: "21"},
+		"let access":        {template: `{{ x.let }}`, expected: "22"},
+		"contentFor":        {template: `{{ contentFor }}`, expected: "19"},
+		"contentFor access": {template: `{{ x.contentFor }}`, expected: "20"},
+	}
+
+	data := map[string]any{
+		"block":      1,
+		"define":     3,
+		"page":       map[string]any{"block": 2, "define": 4, "if": 5, "range": 6},
+		"switch":     7,
+		"case":       8,
+		"item":       map[string]any{"case": 9},
+		"list":       []int{1, 2},
+		"slot":       10,
+		"layout":     map[string]any{"slot": 11, "yield": 12},
+		"do":         13,
+		"capture":    15,
+		"defined":    17,
+		"contentFor": 19,
+		"let":        21,
+		"with":       23,
+		"break":      25,
+		"continue":   27,
+		"x":          map[string]any{"do": 14, "capture": 16, "defined": 18, "contentFor": 20, "let": 22, "with": 24, "break": 26, "continue": 28},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, data)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_Pipe(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"single":     {template: `{{ name | upper }}`, expected: "FOX"},
+		"chained":    {template: `{{ padded | trim | upper }}`, expected: "FOX"},
+		"arguments":  {template: `{{ price | format("%.2f") }}`, expected: "9.50"},
+		"with calls": {template: `{{ upper(trim(padded)) | format("<%s>") }}`, expected: "<FOX>"},
+		"operators":  {template: `{{ count * 2 | format("%d") }}`, expected: "4"},
+		"method":     {template: `{{ "Fox" | user.Greet }}`, expected: "Hello Fox"},
+		"truncate":   {template: `{{ title | upper | truncate(5) }}`, expected: "THE X"},
+	}
+
+	helpers := map[string]any{
+		"upper":  strings.ToUpper,
+		"trim":   strings.TrimSpace,
+		"format": func(v any, format string) string { return fmt.Sprintf(format, v) },
+		"truncate": func(s string, n int) string {
+			if len(s) <= n {
+				return s
+			}
+			return s[:n]
+		},
+	}
+	data := map[string]any{
+		"name":   "Fox",
+		"padded": "  Fox ",
+		"title":  "The X-Files",
+		"price":  9.5,
+		"count":  2,
+		"user":   map[string]any{"Greet": func(s string) string { return "Hello " + s }},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithEscapeFunc(NoEscape))
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(helpers, data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_Do(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{ do track("a"); track("b") }}{{ do $count = count(); }}{{ $count }}`)
+	require.NoError(t, err)
+
+	tracked := make([]string, 0)
+	helpers := map[string]any{
+		"track": func(s string) string {
+			tracked = append(tracked, s)
+			return s
+		},
+		"count": func() int { return len(tracked) },
+	}
+
+	out, err := template.ExecuteString(helpers, map[string]any{})
+	require.NoError(t, err)
+
+	require.Equal(t, "2", out)
+	require.Equal(t, []string{"a", "b"}, tracked)
+}
+
+func TestTemplate_Capture(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"basic":    {template: `{{ capture $greeting }}<b>Hi {{ name }}</b>{{ end }}[{{ $greeting }}]`, expected: "[<b>Hi &lt;Fox&gt;</b>]"},
+		"range":    {template: `{{ capture $list }}{{ range $i, $n in names }}<li>{{ $n }}</li>{{ end }}{{ end }}<ul>{{ $list }}</ul>`, expected: "<ul><li>a</li><li>b</li></ul>"},
+		"if":       {template: `{{ capture $title }}{{ if name }}{{ name }}{{ else }}Anonymous{{ end }}{{ end }}{{ $title }}`, expected: "&lt;Fox&gt;"},
+		"nested":   {template: `{{ capture $outer }}({{ capture $inner }}inner{{ end }}{{ $inner }}){{ end }}{{ $outer }}`, expected: "(inner)"},
+		"unused":   {template: `{{ capture $unused }}hidden{{ end }}shown`, expected: "shown"},
+		"argument": {template: `{{ capture $body }}<p>{{ name }}</p>{{ end }}{{ wrap($body) }}`, expected: "<div><p>&lt;Fox&gt;</p></div>"},
+		"scoped":   {template: `{{ if true }}{{ capture $inner }}inner{{ end }}{{ end }}[{{ $inner }}]`, expected: "[]"},
+	}
+
+	helpers := map[string]any{
+		"wrap": func(s Safe) Safe { return "<div>" + s + "</div>" },
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithEscapeFunc(HTMLEscape))
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(helpers, map[string]any{"name": "<Fox>", "names": []string{"a", "b"}})
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_Raw(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"basic":     {template: `{{ raw }}{{ name }}{{ end }} {{ name }}`, expected: "{{ name }} Fox"},
+		"keywords":  {template: `{{raw}}{{ if }}{{ range }} {{ else }}{{ end }}{{ end }}{{end}}`, expected: "{{ if }}{{ range }} {{ else }}{{ end }}{{ end }}"},
+		"blocks":    {template: `{{ raw }}{{ if }}{{ end }}x{{ end }}`, expected: "{{ if }}{{ end }}x"},
+		"raw":       {template: `{{ raw }}{{ raw }}{{ name }}{{ end }}{{ end }}`, expected: "{{ raw }}{{ name }}{{ end }}"},
+		"multiline": {template: "{{ raw }}\n{{ name }}\n{{ end }}\n{{ name }}", expected: "\n{{ name }}\n\nFox"},
+		"empty":     {template: `[{{ raw }}{{ end }}]`, expected: "[]"},
+		"nested":    {template: `{{ if name }}{{ raw }}{{ name }}{{ end }}{{ end }}`, expected: "{{ name }}"},
+		"unescaped": {template: `{{ raw }}<b>{{ end }}`, expected: "<b>"},
+		"data":      {template: `{{ raw.Name }}`, expected: "Dana"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithEscapeFunc(HTMLEscape))
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, map[string]any{"name": "Fox", "raw": map[string]any{"Name": "Dana"}})
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_RawDelimiters(t *testing.T) {
+	template, err := NewTemplate("hello.html", `<% raw %><% name %> {{ name }}<% end %>`, WithDelimiters("<%", "%>"))
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<% name %> {{ name }}", out)
+
+	_, err = NewTemplate("hello.html", "{{ raw }}\n{{ name }}")
+	require.ErrorContains(t, err, "unclosed raw block starting on line 1")
+}
+
+func TestTemplate_IntegerLiterals(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"hex":         {template: `{{ 0xFF }}`, expected: "255"},
+		"octal":       {template: `{{ 0o17 }}`, expected: "15"},
+		"zero":        {template: `{{ 0 }}`, expected: "0"},
+		"binary":      {template: `{{ 0b1010 }}`, expected: "10"},
+		"underscores": {template: `{{ 1_000 }}`, expected: "1000"},
+		"millions":    {template: `{{ 1_000_000 }}`, expected: "1000000"},
+		"negative":    {template: `{{ -0x10 }}`, expected: "-16"},
+		"math":        {template: `{{ 0x10 + 1 }}`, expected: "17"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(nil, map[string]any{})
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_InvalidIntegerLiteral(t *testing.T) {
+	_, err := NewTemplate("hello.html", "hi\n{{ 0xZZ }}")
+	require.EqualError(t, err, "could not create template: invalid number 0xZZ on line 2:\n{{ 0xZZ }}")
+}
+
+func TestTemplate_LeadingZeroIntegerLiteral(t *testing.T) {
+	_, err := NewTemplate("hello.html", "{{ 010 }}")
+	require.EqualError(t, err, "could not create template: invalid number 010, leading zeros are not allowed, use the 0o prefix for octal on line 1:\n{{ 010 }}")
+}
+
+func TestTemplate_UnclosedAction(t *testing.T) {
+	_, err := NewTemplate("hello.html", "<h1>hi</h1>\n<p>{{ name</p>")
+	require.EqualError(t, err, "could not create template: unclosed {{ opened on line 2:\n<p>{{ name</p>")
+
+	_, err = NewTemplate("hello.html", `{{ "hello }}`)
+	require.EqualError(t, err, "could not create template: unclosed string opened on line 1:\n{{ \"hello }}")
+}
+
+func TestTemplate_PipeErrors(t *testing.T) {
+	helpers := map[string]any{
+		"upper": strings.ToUpper,
+		"fail":  func(s string) string { panic("oops") },
+	}
+
+	template, err := NewTemplate("hello.html", "{{ name | upper }}\n{{ name | upper | missing }}")
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(helpers, map[string]any{"name": "Fox"})
+	require.ErrorContains(t, err, "function 'missing' not defined in `hello.html` starting on line 2")
+
+	template, err = NewTemplate("hello.html", "\n{{ name | upper | fail }}")
+	require.NoError(t, err)
+
+	_, err = template.ExecuteString(helpers, map[string]any{"name": "Fox"})
+	require.ErrorContains(t, err, "error calling function 'fail': oops in `hello.html` starting on line 2")
+}
+
+func TestTemplate_Switch(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{switch status}}
+	{{case "active"}}Active{{case "pending", "new"}}Pending{{case count}}Count{{else}}Unknown{{end}}`)
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		data     map[string]any
+		expected string
+	}{
+		"first case":    {data: map[string]any{"status": "active"}, expected: "Active"},
+		"multiple":      {data: map[string]any{"status": "new"}, expected: "Pending"},
+		"expression":    {data: map[string]any{"status": int64(2), "count": 2}, expected: "Count"},
+		"else":          {data: map[string]any{"status": "closed"}, expected: "Unknown"},
+		"nil subject":   {data: map[string]any{"count": 3}, expected: "Unknown"},
+		"first matches": {data: map[string]any{"status": "active", "count": "active"}, expected: "Active"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := template.ExecuteString(nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_SwitchWithoutElse(t *testing.T) {
+	template, err := NewTemplate("hello.html", `a{{switch status}}{{case "active"}}Active{{end}}b`)
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{"status": "closed"})
+	require.NoError(t, err)
+	require.Equal(t, "ab", out)
+}
+
+func TestTemplate_SwitchBreak(t *testing.T) {
+	template, err := NewTemplate("hello.html", `{{range $_, $n in [1, 2, 3]}}{{switch $n}}{{case 2}}{{break}}{{else}}{{$n}}{{end}}{{end}}`)
+	require.NoError(t, err)
+
+	out, err := template.ExecuteString(nil, map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, "1", out)
+}
+
+func TestTemplate_Defined(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"present":       {template: `{{ defined name }}`, data: map[string]any{"name": ""}, expected: "true"},
+		"nil":           {template: `{{ defined name }}`, data: map[string]any{"name": nil}, expected: "true"},
+		"missing":       {template: `{{ defined name }}`, data: map[string]any{}, expected: "false"},
+		"variable":      {template: `{{ $a = nil }}{{ defined $a }} {{ defined $b }}`, data: map[string]any{}, expected: "true false"},
+		"not":           {template: `{{ if !defined name }}missing{{ end }}`, data: map[string]any{}, expected: "missing"},
+		"and missing":   {template: `{{ if defined Errors && len(Errors) > 0 }}errors{{ else }}ok{{ end }}`, data: map[string]any{}, expected: "ok"},
+		"and present":   {template: `{{ if defined Errors && len(Errors) > 0 }}errors{{ else }}ok{{ end }}`, data: map[string]any{"Errors": []string{"bad"}}, expected: "errors"},
+		"or":            {template: `{{ if defined a || defined b }}yes{{ else }}no{{ end }}`, data: map[string]any{"b": 1}, expected: "yes"},
+		"or neither":    {template: `{{ if defined a || defined b }}yes{{ else }}no{{ end }}`, data: map[string]any{}, expected: "no"},
+		"and precedes":  {template: `{{ a || b && c }}`, data: map[string]any{"a": true, "b": false, "c": false}, expected: "true"},
+		"with equality": {template: `{{ a == 1 && b == 2 }}`, data: map[string]any{"a": 1, "b": 2}, expected: "true"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template)
+			require.NoError(t, err)
+
+			out, err := template.ExecuteString(map[string]any{"len": func(v []string) int { return len(v) }}, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+func TestTemplate_With(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+	}{
+		"struct":          {template: `{{with order.Address}}{{.City}}, {{.Zip}}{{end}}`, data: map[string]any{"order": map[string]any{"Address": address{City: "Washington", Zip: "20535"}}}, expected: "Washington, 20535"},
+		"pointer":         {template: `{{with address}}{{.City}}{{end}}`, data: map[string]any{"address": &address{City: "Washington"}}, expected: "Washington"},
+		"context":         {template: `{{with name}}<b>{{.}}</b>{{end}}`, data: map[string]any{"name": "Fox"}, expected: "<b>Fox</b>"},
+		"nil":             {template: `a{{with address}}{{.City}}{{end}}b`, data: map[string]any{}, expected: "ab"},
+		"nil else":        {template: `{{with address}}{{.City}}{{else}}No address{{end}}`, data: map[string]any{"address": (*address)(nil)}, expected: "No address"},
+		"nested":          {template: `{{with user}}{{with .Name}}{{.First}}{{end}} {{.Name.Last}}{{end}}`, data: map[string]any{"user": user{Name: name{First: "Fox", Last: "Mulder"}}}, expected: "Fox Mulder"},
+		"zero":            {template: `{{with count}}{{.}}{{else}}none{{end}}`, data: map[string]any{"count": 0}, expected: "none"},
+		"false":           {template: `{{with ok}}yes{{else}}no{{end}}`, data: map[string]any{"ok": false}, expected: "no"},
+		"empty string":    {template: `a{{with name}}{{.}}{{end}}b`, data: map[string]any{"name": ""}, expected: "ab"},
+		"empty slice":     {template: `{{with names}}{{.}}{{else}}none{{end}}`, data: map[string]any{"names": []string{}}, expected: "none"},
+		"empty map":       {template: `{{with opts}}{{.}}{{else}}none{{end}}`, data: map[string]any{"opts": map[string]any{}}, expected: "none"},
+		"nil slice":       {template: `{{with names}}{{.}}{{else}}none{{end}}`, data: map[string]any{"names": []string(nil)}, expected: "none"},
+		"non-zero":        {template: `{{with count}}{{.}}{{else}}none{{end}}`, data: map[string]any{"count": 3}, expected: "3"},
+		"zero struct":     {template: `{{with address}}[{{.City}}]{{else}}none{{end}}`, data: map[string]any{"address": address{}}, expected: "[]"},
+		"range":           {template: `{{with names}}{{range $_, $name in .}}{{$name}}{{end}}{{end}}`, data: map[string]any{"names": []string{"a", "b"}}, expected: "ab"},
+		"variable":        {template: `{{with $a = order.Address}}{{$a.City}} {{.Zip}}{{end}}`, data: map[string]any{"order": map[string]any{"Address": address{City: "Washington", Zip: "20535"}}}, expected: "Washington 20535"},
+		"variable nested": {template: `{{with $u = user}}{{with $n = $u.Name}}{{$n.First}} {{$u.Name.Last}}{{end}}{{end}}`, data: map[string]any{"user": user{Name: name{First: "Fox", Last: "Mulder"}}}, expected: "Fox Mulder"},
+		"variable nil":    {template: `{{with $a = address}}{{$a.City}}{{else}}none{{end}}`, data: map[string]any{}, expected: "none"},
+		"variable scope":  {template: `{{with $a = name}}{{$a}}{{end}}[{{$a}}]`, data: map[string]any{"name": "Fox"}, expected: "Fox[]"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			template, err := NewTemplate("hello.html", tc.template, WithEscapeFunc(NoEscape))
+			require.NoError(t, err)
+
+			b := new(bytes.Buffer)
+			err = template.Execute(b, nil, tc.data)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
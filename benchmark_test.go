@@ -70,3 +70,53 @@ func BenchmarkRangeIf(b *testing.B) {
 	})
 
 }
+
+func BenchmarkRenderSized(b *testing.B) {
+	engine := NewEngine(HTMLEscape)
+	err := engine.Register("large.html", `{{range $i, $row in Rows}}<tr><td>{{$i}}</td><td>{{$row}}</td></tr>{{end}}`)
+	require.NoError(b, err)
+
+	rows := make([]string, 1000)
+	for i := range rows {
+		rows[i] = "Fox Mulder and Dana Scully"
+	}
+	args := map[string]any{"Rows": rows}
+
+	out := new(bytes.Buffer)
+	err = engine.Render(out, "large.html", args)
+	require.NoError(b, err)
+	hint := out.Len()
+
+	b.Run("unhinted", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = engine.Render(io.Discard, "large.html", args)
+		}
+	})
+
+	b.Run("hinted", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = engine.RenderSized(io.Discard, "large.html", args, hint)
+		}
+	})
+}
+
+func BenchmarkExecuteString(b *testing.B) {
+	batTemplate, err := NewTemplate("hello.html", `{{range $_, $name in Names}}Hello {{$name}}{{end}}`, WithEscapeFunc(HTMLEscape))
+	require.NoError(b, err)
+
+	args := map[string]any{"Names": []string{"Fox", "Dana", "Smoking Man"}}
+
+	b.Run("bytes.Buffer", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			out := new(bytes.Buffer)
+			_ = batTemplate.Execute(out, nil, args)
+			_ = out.String()
+		}
+	})
+
+	b.Run("ExecuteString", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = batTemplate.ExecuteString(nil, args)
+		}
+	})
+}
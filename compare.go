@@ -3,6 +3,7 @@ package bat
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 func compare(left reflect.Value, right reflect.Value) bool {
@@ -20,6 +21,86 @@ func compare(left reflect.Value, right reflect.Value) bool {
 	return false
 }
 
+// contains returns true if the given collection contains item. Slices and
+// arrays are checked for an equal element, with numbers compared by value, maps
+// for a key, and strings for a substring. A nil collection contains nothing.
+func contains(collection any, item any) (bool, error) {
+	c := reflect.ValueOf(collection)
+	v := reflect.ValueOf(item)
+
+	if c.Kind() == reflect.Pointer {
+		c = c.Elem()
+	}
+
+	switch c.Kind() {
+	case reflect.Invalid:
+		return false, nil
+	case reflect.Map:
+		return hasKey(c, v), nil
+	case reflect.String:
+		if v.Kind() != reflect.String {
+			return false, fmt.Errorf("can't check membership of %s in string", v.Kind())
+		}
+
+		return strings.Contains(c.String(), v.String()), nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < c.Len(); i++ {
+			elem := c.Index(i)
+			if elem.Kind() == reflect.Interface {
+				elem = elem.Elem()
+			}
+
+			if equal, ok := numbersEqual(elem, v); ok {
+				if equal {
+					return true, nil
+				}
+
+				continue
+			}
+
+			// Numbers are never equal to other types, e.g. 1 in ["\x01"]
+			if genericType(elem) != coreInvalid || genericType(v) != coreInvalid {
+				continue
+			}
+
+			if compare(elem, v) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	default:
+		return false, fmt.Errorf("can't check membership in %s", c.Kind())
+	}
+}
+
+// hasKey returns true if the map m has the key k, converting numeric keys to
+// the map's key type when it doesn't change their value.
+func hasKey(m reflect.Value, k reflect.Value) bool {
+	if !k.IsValid() {
+		return false
+	}
+
+	keyType := m.Type().Key()
+	switch {
+	case k.Type().AssignableTo(keyType):
+	case genericType(k) != coreInvalid && genericType(reflect.Zero(keyType)) != coreInvalid:
+		converted := k.Convert(keyType)
+
+		// Keys that can't be converted without losing their value, e.g. 1.5
+		// for an int key, can't be in the map
+		if equal, _ := numbersEqual(converted, k); !equal {
+			return false
+		}
+
+		k = converted
+	default:
+		return false
+	}
+
+	return m.MapIndex(k).IsValid()
+}
+
 func lessThan(leftValue any, rightValue any) (bool, error) {
 	left := reflect.ValueOf(leftValue)
 	right := reflect.ValueOf(rightValue)
@@ -35,6 +116,8 @@ func lessThan(leftValue any, rightValue any) (bool, error) {
 			return left.Uint() < right.Uint(), nil
 		case reflect.Float32, reflect.Float64:
 			return left.Float() < right.Float(), nil
+		case reflect.String:
+			return left.String() < right.String(), nil
 		default:
 			return false, fmt.Errorf("can't compare type %s", lKind)
 		}
@@ -61,6 +144,37 @@ func lessThan(leftValue any, rightValue any) (bool, error) {
 	return false, fmt.Errorf("can't compare type %s and %s", lKind, rKind)
 }
 
+// numbersEqual compares numbers of any type by value, e.g. int 1 and float64
+// 1.0 are equal while 1 and 1.5 aren't. ok is false when either value isn't a
+// number.
+func numbersEqual(left reflect.Value, right reflect.Value) (equal bool, ok bool) {
+	lCore := genericType(left)
+	rCore := genericType(right)
+
+	switch {
+	case lCore == coreInvalid || rCore == coreInvalid:
+		return false, false
+	case lCore == coreInt && rCore == coreInt:
+		return left.Int() == right.Int(), true
+	case lCore == coreUint && rCore == coreUint:
+		return left.Uint() == right.Uint(), true
+	case lCore == coreFloat && rCore == coreFloat:
+		return left.Float() == right.Float(), true
+	case lCore == coreInt && rCore == coreUint:
+		return left.Int() >= 0 && uint64(left.Int()) == right.Uint(), true
+	case lCore == coreUint && rCore == coreInt:
+		return right.Int() >= 0 && left.Uint() == uint64(right.Int()), true
+	case lCore == coreFloat && rCore == coreInt:
+		return left.Float() == float64(right.Int()), true
+	case lCore == coreInt && rCore == coreFloat:
+		return float64(left.Int()) == right.Float(), true
+	case lCore == coreFloat && rCore == coreUint:
+		return left.Float() == float64(right.Uint()), true
+	default:
+		return float64(left.Uint()) == right.Float(), true
+	}
+}
+
 func greaterThan(left any, right any) (bool, error) {
 	return lessThan(right, left)
 }
@@ -100,6 +214,24 @@ func isNil(v reflect.Value) bool {
 	return false
 }
 
+// isEmpty returns true for values that `with` skips, mirroring text/template:
+// nil, zero numbers, false, and empty strings, slices, arrays, maps, and
+// channels. Structs are never empty.
+func isEmpty(v reflect.Value) bool {
+	if isNil(v) {
+		return true
+	}
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
 func isTruthy(v reflect.Value) bool {
 	if isNil(v) {
 		return false
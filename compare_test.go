@@ -83,6 +83,9 @@ func TestLessThan(t *testing.T) {
 		"mixed int uint":   {left: 1, right: uint(5), expected: true},
 		"mixed int float":  {left: 1, right: 5.0, expected: true},
 		"mixed uint float": {left: uint(1), right: 5.0, expected: true},
+		"strings":          {left: "Dana", right: "Fox", expected: true},
+		"string prefix":    {left: "Fox", right: "Foxes", expected: true},
+		"safe and string":  {left: Safe("a"), right: "b", expected: true},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
@@ -96,3 +99,51 @@ func TestLessThan(t *testing.T) {
 		})
 	}
 }
+
+func TestContains(t *testing.T) {
+	testCases := map[string]struct {
+		collection any
+		item       any
+		expected   bool
+	}{
+		"string slice":          {collection: []string{"open", "pending"}, item: "open", expected: true},
+		"string slice missing":  {collection: []string{"open", "pending"}, item: "closed", expected: false},
+		"any slice":             {collection: []any{"open", 1}, item: 1, expected: true},
+		"array":                 {collection: [2]int{1, 2}, item: 2, expected: true},
+		"nil item":              {collection: []any{"open", nil}, item: nil, expected: true},
+		"mixed int types":       {collection: []int64{1, 2}, item: 2, expected: true},
+		"float not in ints":     {collection: []int{1, 2}, item: 1.5, expected: false},
+		"float equal to int":    {collection: []int{1, 2}, item: 2.0, expected: true},
+		"int in floats":         {collection: []float64{1.5, 2}, item: 2, expected: true},
+		"negative not in uints": {collection: []uint8{255}, item: -1, expected: false},
+		"int not in strings":    {collection: []string{"\x01", "1"}, item: 1, expected: false},
+		"string not in ints":    {collection: []any{1}, item: "1", expected: false},
+		"empty slice":           {collection: []string{}, item: "open", expected: false},
+		"nil item not in slice": {collection: []string{"open"}, item: nil, expected: false},
+		"map key":               {collection: map[string]int{"theme": 1}, item: "theme", expected: true},
+		"map key missing":       {collection: map[string]int{"theme": 1}, item: "locale", expected: false},
+		"map int key":           {collection: map[int64]string{1: "one"}, item: 1, expected: true},
+		"map mismatched key":    {collection: map[string]int{"1": 1}, item: 1, expected: false},
+		"map float key":         {collection: map[int]string{1: "one"}, item: 1.5, expected: false},
+		"map whole float key":   {collection: map[int]string{1: "one"}, item: 1.0, expected: true},
+		"map nil key":           {collection: map[string]int{"theme": 1}, item: nil, expected: false},
+		"nil map":               {collection: map[string]int(nil), item: "theme", expected: false},
+		"substring":             {collection: "hello world", item: "lo w", expected: true},
+		"substring missing":     {collection: "hello world", item: "bye", expected: false},
+		"nil collection":        {collection: nil, item: "open", expected: false},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			val, err := contains(tc.collection, tc.item)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, val)
+		})
+	}
+
+	_, err := contains(1, 1)
+	require.EqualError(t, err, "can't check membership in int")
+
+	_, err = contains("123", 1)
+	require.EqualError(t, err, "can't check membership of int in string")
+}
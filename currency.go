@@ -0,0 +1,81 @@
+package bat
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// currencyFormat describes how to format amounts of a given currency.
+type currencyFormat struct {
+	symbol   string
+	decimals int
+}
+
+// currencyFormats are the currencies with known symbols. Other currency codes
+// are formatted with the code as the prefix, e.g. "CHF 1,234.56".
+var currencyFormats = map[string]currencyFormat{
+	"USD": {symbol: "$", decimals: 2},
+	"CAD": {symbol: "CA$", decimals: 2},
+	"AUD": {symbol: "A$", decimals: 2},
+	"EUR": {symbol: "€", decimals: 2},
+	"GBP": {symbol: "£", decimals: 2},
+	"JPY": {symbol: "¥", decimals: 0},
+}
+
+// formatCurrency formats amount using en-US grouping, e.g. "$1,234.56".
+// Integers are treated as the currency's minor unit (e.g. cents), and floats
+// are treated as the major unit (e.g. dollars).
+func formatCurrency(amount any, code string) string {
+	format, ok := currencyFormats[strings.ToUpper(code)]
+	if !ok {
+		format = currencyFormat{symbol: strings.ToUpper(code) + " ", decimals: 2}
+	}
+
+	scale := math.Pow10(format.decimals)
+
+	var minor int64
+	v := reflect.ValueOf(amount)
+	switch genericType(v) {
+	case coreInt:
+		minor = v.Int()
+	case coreUint:
+		minor = int64(v.Uint())
+	case coreFloat:
+		minor = int64(math.Round(v.Float() * scale))
+	default:
+		panic(fmt.Sprintf("can't format %s as currency", v.Kind()))
+	}
+
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	major := minor / int64(scale)
+	out := sign + format.symbol + groupThousands(strconv.FormatInt(major, 10))
+
+	if format.decimals > 0 {
+		fraction := minor % int64(scale)
+		out += fmt.Sprintf(".%0*d", format.decimals, fraction)
+	}
+
+	return out
+}
+
+// groupThousands inserts commas between each group of three digits.
+func groupThousands(digits string) string {
+	var b strings.Builder
+
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
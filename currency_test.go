@@ -0,0 +1,37 @@
+package bat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatCurrency(t *testing.T) {
+	testCases := map[string]struct {
+		amount   any
+		code     string
+		expected string
+	}{
+		"integer cents":        {amount: 123456, code: "USD", expected: "$1,234.56"},
+		"small integer cents":  {amount: 5, code: "USD", expected: "$0.05"},
+		"negative cents":       {amount: -123456789, code: "USD", expected: "-$1,234,567.89"},
+		"uint cents":           {amount: uint(100), code: "USD", expected: "$1.00"},
+		"float dollars":        {amount: 1234.56, code: "USD", expected: "$1,234.56"},
+		"float rounding":       {amount: 0.125, code: "USD", expected: "$0.13"},
+		"large float":          {amount: 1000000.0, code: "usd", expected: "$1,000,000.00"},
+		"euros":                {amount: 99.9, code: "EUR", expected: "€99.90"},
+		"no minor unit":        {amount: 123456, code: "JPY", expected: "¥123,456"},
+		"unknown currency":     {amount: 1234.5, code: "CHF", expected: "CHF 1,234.50"},
+		"hundreds not grouped": {amount: 999.0, code: "GBP", expected: "£999.00"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, formatCurrency(tc.amount, tc.code))
+		})
+	}
+
+	require.PanicsWithValue(t, "can't format string as currency", func() {
+		formatCurrency("12", "USD")
+	})
+}
@@ -0,0 +1,191 @@
+package bat
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/blakewilliams/bat/internal/mapsort"
+)
+
+const (
+	// debugMaxOutput is the maximum number of bytes the debug helper will
+	// output before truncating.
+	debugMaxOutput = 64 * 1024
+	// debugMaxString is the maximum length of a string value before it is
+	// truncated in debug output.
+	debugMaxString = 256
+)
+
+// dumper pretty-prints arbitrary values for the debug helper.
+type dumper struct {
+	out       strings.Builder
+	visited   map[uintptr]bool
+	truncated bool
+}
+
+// dump returns a human readable representation of v, including struct field
+// names and nested values.
+func dump(v any) string {
+	d := &dumper{visited: make(map[uintptr]bool)}
+	d.dump(reflect.ValueOf(v), 0)
+
+	if d.truncated {
+		d.out.WriteString("\n... (truncated)")
+	}
+
+	return d.out.String()
+}
+
+func (d *dumper) write(format string, args ...any) {
+	if d.truncated {
+		return
+	}
+
+	if d.out.Len() > debugMaxOutput {
+		d.truncated = true
+		return
+	}
+
+	fmt.Fprintf(&d.out, format, args...)
+}
+
+func (d *dumper) indent(depth int) {
+	d.write("%s", strings.Repeat("  ", depth))
+}
+
+func (d *dumper) dump(v reflect.Value, depth int) {
+	if !v.IsValid() {
+		d.write("nil")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			d.write("nil")
+			return
+		}
+
+		d.dump(v.Elem(), depth)
+	case reflect.Pointer:
+		if v.IsNil() {
+			d.write("(%s)(nil)", v.Type())
+			return
+		}
+
+		if d.visited[v.Pointer()] {
+			d.write("(%s)(cycle)", v.Type())
+			return
+		}
+
+		// Only dereference one level of pointers
+		if v.Elem().Kind() == reflect.Pointer {
+			d.write("(%s)(%#x)", v.Type(), v.Pointer())
+			return
+		}
+
+		d.visited[v.Pointer()] = true
+		d.write("&")
+		d.dump(v.Elem(), depth)
+		delete(d.visited, v.Pointer())
+	case reflect.Struct:
+		d.write("%s{", v.Type())
+		if v.NumField() > 0 {
+			d.write("\n")
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			d.indent(depth + 1)
+			d.write("%s: ", v.Type().Field(i).Name)
+			d.dump(v.Field(i), depth+1)
+			d.write(",\n")
+		}
+
+		if v.NumField() > 0 {
+			d.indent(depth)
+		}
+		d.write("}")
+	case reflect.Map:
+		if v.IsNil() {
+			d.write("%s(nil)", v.Type())
+			return
+		}
+
+		if d.visited[v.Pointer()] {
+			d.write("%s(cycle)", v.Type())
+			return
+		}
+		d.visited[v.Pointer()] = true
+
+		d.write("%s{", v.Type())
+		if v.Len() > 0 {
+			d.write("\n")
+		}
+
+		sorted := mapsort.Sort(v)
+		for i := range sorted.Keys {
+			d.indent(depth + 1)
+			d.dump(sorted.Keys[i], depth+1)
+			d.write(": ")
+			d.dump(sorted.Values[i], depth+1)
+			d.write(",\n")
+		}
+
+		if v.Len() > 0 {
+			d.indent(depth)
+		}
+		d.write("}")
+		delete(d.visited, v.Pointer())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				d.write("%s(nil)", v.Type())
+				return
+			}
+
+			if d.visited[v.Pointer()] && v.Len() > 0 {
+				d.write("%s(cycle)", v.Type())
+				return
+			}
+			d.visited[v.Pointer()] = true
+			defer delete(d.visited, v.Pointer())
+		}
+
+		d.write("%s{", v.Type())
+		if v.Len() > 0 {
+			d.write("\n")
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			d.indent(depth + 1)
+			d.dump(v.Index(i), depth+1)
+			d.write(",\n")
+		}
+
+		if v.Len() > 0 {
+			d.indent(depth)
+		}
+		d.write("}")
+	case reflect.String:
+		s := v.String()
+		if len(s) > debugMaxString {
+			d.write("%q...", s[:debugMaxString])
+			return
+		}
+
+		d.write("%q", s)
+	case reflect.Bool:
+		d.write("%t", v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		d.write("%d", v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		d.write("%d", v.Uint())
+	case reflect.Float32, reflect.Float64:
+		d.write("%g", v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		d.write("%g", v.Complex())
+	default:
+		d.write("%s", v.Type())
+	}
+}
@@ -0,0 +1,66 @@
+package bat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type debugNode struct {
+	Name     string
+	Next     *debugNode
+	tags     map[string]int
+	Children []string
+}
+
+func TestDump(t *testing.T) {
+	node := &debugNode{
+		Name:     "root",
+		tags:     map[string]int{"b": 2, "a": 1},
+		Children: []string{"foo"},
+	}
+
+	expected := `&bat.debugNode{
+  Name: "root",
+  Next: (*bat.debugNode)(nil),
+  tags: map[string]int{
+    "a": 1,
+    "b": 2,
+  },
+  Children: []string{
+    "foo",
+  },
+}`
+	require.Equal(t, expected, dump(node))
+}
+
+func TestDump_Cycle(t *testing.T) {
+	node := &debugNode{Name: "root"}
+	node.Next = node
+
+	output := dump(node)
+	require.Contains(t, output, "Next: (*bat.debugNode)(cycle)")
+}
+
+func TestDump_Nil(t *testing.T) {
+	require.Equal(t, "nil", dump(nil))
+}
+
+func TestDump_LongString(t *testing.T) {
+	output := dump(strings.Repeat("a", debugMaxString+10))
+
+	require.True(t, strings.HasSuffix(output, `"...`))
+	require.Len(t, output, debugMaxString+5)
+}
+
+func TestDump_Truncated(t *testing.T) {
+	values := make([]string, 0, debugMaxOutput)
+	for i := 0; i < debugMaxOutput; i++ {
+		values = append(values, "value")
+	}
+
+	output := dump(values)
+	require.True(t, strings.HasSuffix(output, "... (truncated)"))
+	require.Less(t, len(output), debugMaxOutput+100)
+}
@@ -2,44 +2,198 @@ package bat
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/blakewilliams/bat/internal/lexer"
 )
 
 // An Engine represents a collection of templates and helper functions. This
 // allows templates to utilize partials and custom escape functions. For most
 // applications, there should be 1 engine per-filetype.
 type Engine struct {
-	templates  map[string]Template
-	escapeFunc func(string) string
-	helpers    map[string]any
+	// mu guards templates, helpers, and env so that templates can be
+	// registered and removed while rendering.
+	mu            sync.RWMutex
+	templates     map[string]Template
+	escapeFunc    func(string) string
+	helpers       map[string]any
+	env           map[string]any
+	debugDisabled bool
+	leftDelim     string
+	rightDelim    string
+	sanitizer     func(string) string
+	collapse      bool
+	jsonTags      bool
+	reloadFS      fs.FS
+	reloadExt     string
+	// options holds the options templates were registered with using
+	// RegisterWithOptions, so they're kept when templates are reloaded.
+	options map[string][]TemplateOption
+	// modTimes holds the modification time of each template file when it
+	// was last parsed, so changed files can be reloaded.
+	modTimes map[string]time.Time
+	// schemas holds the data each template requires, set using RequireData.
+	schemas map[string]map[string]reflect.Kind
 }
 
+// A function that allows the engine to be customized when using NewEngine.
+type EngineOption = func(*Engine)
+
 // Returns a new engine. NewEngine accepts an escape function that accepts
-// un-escpaed text and returns escaped text safe for output.
-func NewEngine(escapeFunc func(text string) string) *Engine {
+// un-escpaed text and returns escaped text safe for output. Options can be
+// provided to further customize the engine.
+func NewEngine(escapeFunc func(text string) string, opts ...EngineOption) *Engine {
 	engine := &Engine{
 		escapeFunc: escapeFunc,
 		templates:  make(map[string]Template),
+		modTimes:   make(map[string]time.Time),
+		options:    make(map[string][]TemplateOption),
+		schemas:    make(map[string]map[string]reflect.Kind),
+		leftDelim:  lexer.DefaultLeftDelim,
+		rightDelim: lexer.DefaultRightDelim,
 	}
 
-	defaultHelpers := map[string]any{
-		"len": func(v any) int {
-			return reflect.ValueOf(v).Len()
-		},
-		"safe": func(s string) Safe {
-			return Safe(s)
-		},
-	}
+	engine.helpers = defaultHelpers(engine)
 
-	engine.helpers = defaultHelpers
+	for _, opt := range opts {
+		opt(engine)
+	}
 
 	return engine
 }
 
+// WithDebugDisabled disables the debug helper so that stray calls to it can't
+// leak data in production. When disabled, the debug helper renders nothing and
+// logs a warning.
+func WithDebugDisabled() EngineOption {
+	return func(e *Engine) {
+		e.debugDisabled = true
+	}
+}
+
+// WithSanitizer provides the function used by the sanitize helper to make
+// untrusted HTML safe to render, e.g. bluemonday's Policy.Sanitize.
+func WithSanitizer(fn func(string) string) EngineOption {
+	return func(e *Engine) {
+		e.sanitizer = fn
+	}
+}
+
+// WithCollapseWhitespace collapses runs of whitespace in the text of
+// registered templates to a single space, reducing the size of the output.
+// Whitespace inside of <pre> and <textarea> tags is preserved, but output from
+// data and helpers is never changed.
+func WithCollapseWhitespace() EngineOption {
+	return func(e *Engine) {
+		e.collapse = true
+	}
+}
+
+// WithJSONTagAccess allows structs to be accessed using brackets and the names
+// in their json tags, e.g. `user["email"]` for a field tagged `json:"email"`,
+// so templates written against JSON data work with Go structs.
+func WithJSONTagAccess() EngineOption {
+	return func(e *Engine) {
+		e.jsonTags = true
+	}
+}
+
+// WithReload re-reads and re-parses templates from dir when they're rendered
+// if their file has been modified since it was last parsed, which is useful
+// during development. Templates are looked up by their path in dir, and only
+// registered names ending in extension are reloaded. Files that don't exist
+// are rendered as they were registered.
+func WithReload(dir fs.FS, extension string) EngineOption {
+	return func(e *Engine) {
+		e.reloadFS = dir
+		e.reloadExt = extension
+	}
+}
+
+// WithEngineDelimiters sets the delimiters used by templates registered with
+// the engine. See WithDelimiters for the requirements delimiters must meet.
+func WithEngineDelimiters(left string, right string) EngineOption {
+	return func(e *Engine) {
+		e.leftDelim = left
+		e.rightDelim = right
+	}
+}
+
+// Clone returns a copy of the engine that shares its registered templates,
+// helpers, and escape function. Templates and helpers registered on the clone
+// don't affect the original engine, and vice versa.
+func (e *Engine) Clone() *Engine {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	clone := &Engine{
+		escapeFunc:    e.escapeFunc,
+		templates:     make(map[string]Template, len(e.templates)),
+		env:           e.env,
+		debugDisabled: e.debugDisabled,
+		leftDelim:     e.leftDelim,
+		rightDelim:    e.rightDelim,
+		sanitizer:     e.sanitizer,
+		collapse:      e.collapse,
+		jsonTags:      e.jsonTags,
+		reloadFS:      e.reloadFS,
+		reloadExt:     e.reloadExt,
+		modTimes:      make(map[string]time.Time, len(e.modTimes)),
+		options:       make(map[string][]TemplateOption, len(e.options)),
+		schemas:       make(map[string]map[string]reflect.Kind, len(e.schemas)),
+	}
+
+	for name, schema := range e.schemas {
+		clone.schemas[name] = schema
+	}
+
+	for name, opts := range e.options {
+		clone.options[name] = opts
+	}
+
+	for name, modTime := range e.modTimes {
+		clone.modTimes[name] = modTime
+	}
+
+	// Default helpers reference the engine they were created for, so the
+	// clone gets its own unless they've been overridden.
+	clone.helpers = defaultHelpers(clone)
+	for name, fn := range e.helpers {
+		if defaultFn, ok := clone.helpers[name]; ok && sameFunc(defaultFn, fn) {
+			continue
+		}
+
+		clone.helpers[name] = fn
+	}
+
+	for name, t := range e.templates {
+		t.helpers = clone.helpers
+		clone.templates[name] = t
+	}
+
+	return clone
+}
+
+// sameFunc returns true if both functions share the same implementation.
+func sameFunc(a any, b any) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// isHTMLEscape returns true if the given escape function is HTMLEscape.
+func isHTMLEscape(fn func(string) string) bool {
+	return sameFunc(fn, HTMLEscape)
+}
+
 // Helper declares a new helper function available to templates by using the
 // provided name.
 //
@@ -49,75 +203,432 @@ func (e *Engine) Helper(name string, fn any) {
 		panic("provided value must be a function")
 	}
 
-	e.helpers[name] = fn
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Templates share the helpers map while rendering, so a copy is modified
+	// and given to the registered templates instead.
+	helpers := make(map[string]any, len(e.helpers)+1)
+	for k, v := range e.helpers {
+		helpers[k] = v
+	}
+	helpers[name] = fn
+	e.helpers = helpers
+
+	for templateName, t := range e.templates {
+		t.helpers = helpers
+		e.templates[templateName] = t
+	}
+}
+
+// SetEnv sets the values available to templates via the env helper, e.g.
+// `{{if env("debug")}}`. This allows templates to render environment specific
+// content without exposing the process environment.
+func (e *Engine) SetEnv(env map[string]any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.env = env
+}
+
+// RequireData declares the data the template with the given name requires and
+// the kind of each value, e.g. {"title": reflect.String}. Rendering the
+// template, including as a partial or layout, returns an error when data is
+// missing or has a different kind. The requirements are kept when the template
+// is registered again, and can be removed by passing a nil schema.
+func (e *Engine) RequireData(name string, schema map[string]reflect.Kind) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if schema == nil {
+		delete(e.schemas, name)
+		return
+	}
+
+	e.schemas[name] = schema
+}
+
+// checkData returns an error describing the data that doesn't match the
+// schema of the template with the given name.
+func (e *Engine) checkData(name string, data map[string]any) error {
+	e.mu.RLock()
+	schema := e.schemas[name]
+	e.mu.RUnlock()
+
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	problems := make([]string, 0)
+	for _, key := range keys {
+		value, ok := data[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("missing '%s'", key))
+			continue
+		}
+
+		if value == nil {
+			problems = append(problems, fmt.Sprintf("'%s' must be %s, got nil", key, schema[key]))
+		} else if kind := reflect.ValueOf(value).Kind(); kind != schema[key] {
+			problems = append(problems, fmt.Sprintf("'%s' must be %s, got %s", key, schema[key], kind))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid data for template %s: %s", name, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// SetDelimiters sets the delimiters used by templates registered after it's
+// called, returning an error if the delimiters are invalid. Templates that are
+// already registered keep the delimiters they were registered with.
+func (e *Engine) SetDelimiters(left string, right string) error {
+	if err := validateDelimiters(left, right); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leftDelim = left
+	e.rightDelim = right
+
+	return nil
 }
 
 // Registers a new template using the given name. Typically name's will be
 // relative file paths. e.g. users/new.batml
 func (e *Engine) Register(name string, input string) error {
-	t, err := NewTemplate(name, input, WithEscapeFunc(e.escapeFunc), WithHelpers(e.helpers))
+	return e.RegisterWithOptions(name, input)
+}
+
+// RegisterWithOptions registers a new template like Register, applying the
+// given options after the engine's options. This allows a template to
+// override the engine, e.g. WithEscapeFunc(NoEscape) for a plain text
+// template in an engine that escapes HTML.
+func (e *Engine) RegisterWithOptions(name string, input string, opts ...TemplateOption) error {
+	t, err := NewTemplate(name, input, append(e.templateOptions(), opts...)...)
 
 	if err != nil {
 		return err
 	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.templates[name] = t
+	if len(opts) > 0 {
+		e.options[name] = opts
+	} else {
+		delete(e.options, name)
+	}
 
 	return nil
 }
 
-// Registers a new template using the given name. Typically name's will be
-// relative file paths. e.g. users/new.batml
-func (e *Engine) RegisterFile(name string, input string) error {
-	t, err := NewTemplate(name, input, WithEscapeFunc(e.escapeFunc), WithHelpers(e.helpers))
+// templateOptions returns the options used to create templates registered
+// with the engine.
+func (e *Engine) templateOptions() []TemplateOption {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return []TemplateOption{
+		WithEscapeFunc(e.escapeFunc),
+		WithHelpers(e.helpers),
+		WithDelimiters(e.leftDelim, e.rightDelim),
+		withCollapseWhitespace(e.collapse),
+		withJSONTags(e.jsonTags),
+	}
+}
+
+// reloadOptions returns the options used to create a new version of the
+// template with the given name, including the options it was registered with.
+func (e *Engine) reloadOptions(name string) []TemplateOption {
+	opts := e.templateOptions()
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return append(opts, e.options[name]...)
+}
+
+// Deregister removes the template with the given name from the engine,
+// returning true if the template was registered.
+func (e *Engine) Deregister(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, ok := e.templates[name]
+	delete(e.templates, name)
+	delete(e.modTimes, name)
+	delete(e.options, name)
+
+	return ok
+}
 
+// Reload replaces an already registered template with a new version, which is
+// useful for reloading templates when they change during development. Other
+// templates aren't affected, and the existing template is kept if input can't
+// be parsed or no template with the given name is registered.
+func (e *Engine) Reload(name string, input string) error {
+	if !e.Exists(name) {
+		return fmt.Errorf("template %s not found", name)
+	}
+
+	t, err := NewTemplate(name, input, e.reloadOptions(name)...)
 	if err != nil {
 		return err
 	}
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The template may have been removed while parsing
+	if _, ok := e.templates[name]; !ok {
+		return fmt.Errorf("template %s not found", name)
+	}
+
 	e.templates[name] = t
 
 	return nil
 }
 
+// Clear removes all templates from the engine.
+func (e *Engine) Clear() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.templates = make(map[string]Template)
+	e.modTimes = make(map[string]time.Time)
+	e.options = make(map[string][]TemplateOption)
+}
+
+// Exists returns true if a template with the given name is registered.
+func (e *Engine) Exists(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	_, ok := e.templates[name]
+
+	return ok
+}
+
+// List returns the sorted names of all registered templates.
+func (e *Engine) List() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	names := make([]string, 0, len(e.templates))
+	for name := range e.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Match returns the sorted names of registered templates matching the given
+// glob pattern, e.g. "pages/*". The pattern syntax is the same as path.Match.
+func (e *Engine) Match(pattern string) ([]string, error) {
+	// Validate the pattern up front so that invalid patterns return an error
+	// even when no templates are registered.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+
+	matches := make([]string, 0)
+	for _, name := range e.List() {
+		if ok, _ := path.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+
+	return matches, nil
+}
+
+// MustRegister is like Register but panics if the template can't be
+// registered. It is intended to be used when initializing an engine at
+// program startup.
+func (e *Engine) MustRegister(name string, input string) {
+	if err := e.Register(name, input); err != nil {
+		panic(fmt.Sprintf("bat: could not register template %s: %s", name, err))
+	}
+}
+
+// Registers a new template using the given name. Typically name's will be
+// relative file paths. e.g. users/new.batml
+func (e *Engine) RegisterFile(name string, input string) error {
+	return e.Register(name, input)
+}
+
 // Renders the template with the given name and data to the provider writer.
 func (e *Engine) Render(w io.Writer, name string, data map[string]any) error {
 	return e.RenderWithHelpers(w, name, nil, data)
 }
 
+// RenderToString renders the template with the given name and data, returning
+// the output as a string.
+func (e *Engine) RenderToString(name string, data map[string]any) (string, error) {
+	return e.RenderWithHelpersToString(name, nil, data)
+}
+
+// RenderWithHelpersToString renders the template with the given name, helpers,
+// and data, returning the output as a string.
+func (e *Engine) RenderWithHelpersToString(name string, helpers map[string]any, data map[string]any) (string, error) {
+	b := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		b.Reset()
+		bufferPool.Put(b)
+	}()
+
+	if err := e.RenderWithHelpers(b, name, helpers, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// RenderSized renders the template with the given name and data to the
+// provided writer, preallocating hint bytes for the rendered output. This
+// avoids repeated buffer growth when rendering templates known to produce
+// large output.
+func (e *Engine) RenderSized(w io.Writer, name string, data map[string]any, hint int) error {
+	return e.render(context.Background(), w, name, nil, data, hint)
+}
+
 func (e *Engine) RenderWithHelpers(w io.Writer, name string, helpers map[string]any, data map[string]any) error {
+	return e.render(context.Background(), w, name, helpers, data, 0)
+}
+
+// RenderContext renders the template with the given name and data to the
+// provided writer, returning ctx.Err() if the context is canceled while
+// rendering. Nothing is written to w when rendering is canceled.
+func (e *Engine) RenderContext(ctx context.Context, w io.Writer, name string, data map[string]any) error {
+	return e.render(ctx, w, name, nil, data, 0)
+}
+
+// renderState holds state that is shared by a template and the partials and
+// layouts it renders, and is reset for each call to Render.
+type renderState struct {
+	// ids holds the last ID returned by uid for each prefix.
+	ids map[string]int
+	// slots holds the content captured by each named slot, so that layouts
+	// can yield it.
+	slots map[string]string
+	// blocks holds the content of each block defined using define, which
+	// replaces the block in layouts.
+	blocks map[string]string
+}
+
+// renderStateKey is the context key for the current renderState.
+type renderStateKey struct{}
+
+// withRenderState returns the renderState stored in ctx, creating and storing
+// a new one if ctx doesn't have one.
+func withRenderState(ctx context.Context) (context.Context, *renderState) {
+	if state, ok := ctx.Value(renderStateKey{}).(*renderState); ok {
+		return ctx, state
+	}
+
+	state := &renderState{
+		ids:    make(map[string]int),
+		slots:  make(map[string]string),
+		blocks: make(map[string]string),
+	}
+	return context.WithValue(ctx, renderStateKey{}, state), state
+}
+
+// renderHelpers are the names of the helpers provided to templates each time
+// they're rendered by the engine.
+var renderHelpers = []string{"uid", "contentFor", "layout", "partial"}
+
+// render renders the named template, growing the internal buffers by hint
+// bytes before executing.
+func (e *Engine) render(ctx context.Context, w io.Writer, name string, helpers map[string]any, data map[string]any, hint int) error {
 	var layoutName string
 	var layoutArgs map[string]any
 	if helpers == nil {
 		helpers = make(map[string]any, 1)
 	}
 
-	helpers["layout"] = func(name string) {
+	// Partials and layouts share the state of the render that included them
+	ctx, state := withRenderState(ctx)
+
+	helpers["uid"] = func(prefix string) string {
+		state.ids[prefix]++
+		return fmt.Sprintf("%s-%d", prefix, state.ids[prefix])
+	}
+
+	template, err := e.template(name)
+	if err != nil {
+		return err
+	}
+
+	// contentFor adds content to a slot without a block, e.g.
+	// `contentFor("head", safe("<meta ...>"))`. Values that aren't Safe are
+	// escaped using the template's escape function.
+	helpers["contentFor"] = func(name string, content any) {
+		state.slots[name] += valueToString(content, template.escapeFunc)
+	}
+
+	// layout accepts an optional map of data that is only passed to the
+	// layout, e.g. `layout("main", {title: "Home"})`
+	helpers["layout"] = func(name string, args ...map[string]any) {
 		if layoutName != "" {
 			panic("layout already set")
 		}
 
+		if len(args) > 1 {
+			panic(fmt.Sprintf("layout accepts at most 1 map of data, got %d", len(args)))
+		}
+
 		layoutName = name
+		if len(args) == 1 {
+			layoutArgs = args[0]
+		}
 	}
 
-	helpers["partial"] = func(name string, data map[string]any) Safe {
+	// partial accepts an optional map of helpers that are only available to
+	// the partial, e.g. `partial("card", {}, {format: formatPrice})`
+	helpers["partial"] = func(name string, data map[string]any, partialHelpers ...map[string]any) Safe {
+		if len(partialHelpers) > 1 {
+			panic(fmt.Sprintf("partial accepts at most 1 map of helpers, got %d", len(partialHelpers)))
+		}
+
+		scoped := helpers
+		if len(partialHelpers) == 1 {
+			scoped = make(map[string]any, len(helpers)+len(partialHelpers[0]))
+			for k, v := range helpers {
+				scoped[k] = v
+			}
+			for k, v := range partialHelpers[0] {
+				scoped[k] = v
+			}
+		}
+
 		out := new(bytes.Buffer)
-		err := e.RenderWithHelpers(out, name, helpers, data)
+		err := e.render(ctx, out, name, scoped, data, 0)
 
 		if err != nil {
-			panic(err)
+			panic(newPartialError(name, err))
 		}
 
 		return Safe(out.String())
 	}
 
-	template, ok := e.templates[name]
-	if !ok {
-		return fmt.Errorf("template %s not found", name)
+	if err := e.checkData(name, data); err != nil {
+		return err
 	}
 
 	var b bytes.Buffer
-	err := template.Execute(&b, helpers, data)
+	if hint > 0 {
+		b.Grow(hint)
+	}
+	err = template.ExecuteContext(ctx, &b, helpers, data)
 	if err != nil {
 		return err
 	}
@@ -138,7 +649,7 @@ func (e *Engine) RenderWithHelpers(w io.Writer, name string, helpers map[string]
 	layoutData["ChildContent"] = Safe(b.String())
 
 	var tb bytes.Buffer
-	err = e.RenderWithHelpers(&tb, layoutName, helpers, layoutData)
+	err = e.render(ctx, &tb, layoutName, helpers, layoutData, hint)
 	if err != nil {
 		return err
 	}
@@ -148,6 +659,196 @@ func (e *Engine) RenderWithHelpers(w io.Writer, name string, helpers map[string]
 	return nil
 }
 
+// PartialError is returned when a partial fails to render, and includes both
+// the line in the partial that failed and the line it was included from.
+type PartialError struct {
+	// Partial is the name of the partial that failed to render.
+	Partial string
+	// Line is the line in the partial that caused the error, or 0 if unknown.
+	Line int
+	// IncludedFrom is the name of the template that rendered the partial.
+	IncludedFrom string
+	// IncludedFromLine is the line the partial was rendered on.
+	IncludedFromLine int
+	// Err is the underlying error.
+	Err error
+}
+
+func newPartialError(name string, err error) *PartialError {
+	partialErr := &PartialError{Partial: name, Err: err}
+
+	// Nested partials report the line the inner partial was included from
+	var nestedErr *PartialError
+	var execErr *ExecutionError
+	if errors.As(err, &nestedErr) {
+		partialErr.Line = nestedErr.IncludedFromLine
+	} else if errors.As(err, &execErr) {
+		partialErr.Line = execErr.Line
+	}
+
+	return partialErr
+}
+
+func (e *PartialError) Error() string {
+	location := fmt.Sprintf("in partial '%s'", e.Partial)
+	if e.Line > 0 {
+		location += fmt.Sprintf(" line %d", e.Line)
+	}
+
+	return fmt.Sprintf("%s\n%s, included from '%s' line %d", e.Err, location, e.IncludedFrom, e.IncludedFromLine)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// RegisterGlob registers each file in dir matching the given pattern, using
+// the path of the file as the name of the template. The pattern syntax is the
+// same as path.Match, with the addition of "**", which matches any number of
+// directories, e.g. "templates/**/*.html".
+func (e *Engine) RegisterGlob(dir fs.FS, pattern string) error {
+	if _, err := matchGlob(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+
+	err := fs.WalkDir(dir, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking directory: %s", err)
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		if ok, _ := matchGlob(pattern, name); !ok {
+			return nil
+		}
+
+		contents, err := fs.ReadFile(dir, name)
+		if err != nil {
+			return fmt.Errorf("error reading file: %s", err)
+		}
+
+		if err := e.Register(name, string(contents)); err != nil {
+			return fmt.Errorf("could not register template %s: %w", name, err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("could not register templates matching %s: %w", pattern, err)
+	}
+
+	return nil
+}
+
+// matchGlob reports whether name matches pattern. Each element of the pattern
+// is matched using path.Match, except for "**" which matches zero or more
+// elements.
+func matchGlob(pattern string, name string) (bool, error) {
+	patterns := strings.Split(pattern, "/")
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return false, err
+		}
+	}
+
+	return matchElems(patterns, strings.Split(name, "/")), nil
+}
+
+func matchElems(patterns []string, elems []string) bool {
+	if len(patterns) == 0 {
+		return len(elems) == 0
+	}
+
+	if patterns[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchElems(patterns[1:], elems[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(elems) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(patterns[0], elems[0]); !ok {
+		return false
+	}
+
+	return matchElems(patterns[1:], elems[1:])
+}
+
+// template returns the template with the given name, reloading it first if
+// reloading is enabled and its file has changed.
+func (e *Engine) template(name string) (Template, error) {
+	if e.reloadFS != nil && strings.HasSuffix(name, e.reloadExt) {
+		if err := e.reloadChanged(name); err != nil {
+			return Template{}, err
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	template, ok := e.templates[name]
+	if !ok {
+		return Template{}, fmt.Errorf("template %s not found", name)
+	}
+
+	return template, nil
+}
+
+// reloadChanged re-parses the file for the template with the given name if
+// it has been modified since it was last parsed. Templates that aren't
+// registered are left alone, so deregistered templates stay deregistered.
+func (e *Engine) reloadChanged(name string) error {
+	if !e.Exists(name) {
+		return nil
+	}
+
+	info, err := fs.Stat(e.reloadFS, name)
+	if err != nil {
+		// The template isn't a file, so it's rendered as registered
+		return nil
+	}
+
+	e.mu.RLock()
+	modTime, ok := e.modTimes[name]
+	e.mu.RUnlock()
+
+	if ok && modTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	contents, err := fs.ReadFile(e.reloadFS, name)
+	if err != nil {
+		return fmt.Errorf("could not reload template %s: %w", name, err)
+	}
+
+	t, err := NewTemplate(name, string(contents), e.reloadOptions(name)...)
+	if err != nil {
+		return fmt.Errorf("could not reload template %s: %w", name, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The template may have been deregistered while it was being parsed
+	if _, ok := e.templates[name]; !ok {
+		return nil
+	}
+
+	e.templates[name] = t
+	e.modTimes[name] = info.ModTime()
+
+	return nil
+}
+
 // AutoRegister recursivly finds all files with the given extension and
 // registers them as a template on the engine. If removePathPrefix is provided,
 // it will register templates without the given prefix.
@@ -159,32 +860,108 @@ func (e *Engine) RenderWithHelpers(w io.Writer, name string, helpers map[string]
 // This is designed to be used with the embed package, allowing templates to be
 // compiled into the resulting binary.
 func (e *Engine) AutoRegister(dir fs.FS, pathPrefix string, extension string) error {
+	return e.AutoRegisterWithTransform(dir, extension, trimPathPrefix(pathPrefix))
+}
+
+// AutoRegisterExtensions recursively finds all files with any of the given
+// extensions and registers them as templates like AutoRegister. Names keep
+// their extension, so "welcome.html" and "welcome.txt" can both be registered.
+func (e *Engine) AutoRegisterExtensions(dir fs.FS, pathPrefix string, extensions ...string) error {
+	return e.autoRegister(dir, trimPathPrefix(pathPrefix), func(path string) ([]TemplateOption, bool) {
+		for _, extension := range extensions {
+			if strings.HasSuffix(path, extension) {
+				return nil, true
+			}
+		}
+
+		return nil, false
+	})
+}
+
+// AutoRegisterWithTransform recursively finds all files with the given
+// extension and registers them as templates like AutoRegister, using transform
+// to map the path of each file to the name of its template.
+//
+// e.g. a transform of
+//
+//	func(path string) string {
+//		return strings.TrimSuffix(strings.TrimPrefix(path, "views/"), ".html")
+//	}
+//
+// registers views/layouts/main.html with a name of "layouts/main".
+func (e *Engine) AutoRegisterWithTransform(dir fs.FS, extension string, transform func(path string) string) error {
+	return e.autoRegister(dir, transform, func(path string) ([]TemplateOption, bool) {
+		return nil, strings.HasSuffix(path, extension)
+	})
+}
+
+// AutoRegisterWithEscaping recursively finds all files with the extensions in
+// escapeFuncs and registers them as templates like AutoRegister, escaping each
+// template with the escape function for its extension. This allows a single
+// engine to render templates that need different escaping.
+//
+// e.g.
+//
+//	e.AutoRegisterWithEscaping(templates, "templates", map[string]func(string) string{
+//		".html": HTMLEscape,
+//		".txt":  NoEscape,
+//	})
+//
+// When more than one extension matches a file, e.g. ".txt" and ".html.txt",
+// the longest extension is used.
+func (e *Engine) AutoRegisterWithEscaping(dir fs.FS, pathPrefix string, escapeFuncs map[string]func(string) string) error {
+	return e.autoRegister(dir, trimPathPrefix(pathPrefix), func(path string) ([]TemplateOption, bool) {
+		extension := ""
+		for ext := range escapeFuncs {
+			if strings.HasSuffix(path, ext) && len(ext) > len(extension) {
+				extension = ext
+			}
+		}
+
+		if extension == "" {
+			return nil, false
+		}
+
+		return []TemplateOption{WithEscapeFunc(escapeFuncs[extension])}, true
+	})
+}
+
+// trimPathPrefix returns a transform for autoRegister that removes the given
+// directory from the start of paths.
+func trimPathPrefix(pathPrefix string) func(path string) string {
 	if pathPrefix != "" && !strings.HasSuffix(pathPrefix, "/") {
 		pathPrefix += "/"
 	}
 
+	return func(path string) string {
+		return strings.TrimPrefix(path, pathPrefix)
+	}
+}
+
+// autoRegister registers each file in dir that match returns true for, with
+// the options match returns. transform returns the name of each template.
+func (e *Engine) autoRegister(dir fs.FS, transform func(path string) string, match func(path string) ([]TemplateOption, bool)) error {
 	err := fs.WalkDir(dir, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("error walking directory: %s", err)
 		}
 
-		if d.IsDir() || !strings.HasSuffix(path, extension) {
+		if d.IsDir() {
 			return nil
 		}
 
-		f, err := dir.Open(path)
-
-		if err != nil {
-			return fmt.Errorf("error opening file: %s", err)
+		opts, ok := match(path)
+		if !ok {
+			return nil
 		}
 
-		contents, err := io.ReadAll(f)
+		contents, err := fs.ReadFile(dir, path)
 		if err != nil {
 			return fmt.Errorf("error reading file: %s", err)
 		}
 
-		friendlyName := strings.TrimPrefix(path, pathPrefix)
-		err = e.Register(friendlyName, string(contents))
+		friendlyName := transform(path)
+		err = e.RegisterWithOptions(friendlyName, string(contents), opts...)
 
 		if err != nil {
 			return fmt.Errorf("could not register template %s: %w", friendlyName, err)
@@ -2,8 +2,16 @@ package bat
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -46,74 +54,1315 @@ func TestEngine_AutoRegister(t *testing.T) {
 	require.Equal(t, "<h1>Hello Fox</h1>\n", b.String())
 }
 
+func TestEngine_WithReload(t *testing.T) {
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	dir := fstest.MapFS{
+		"pages/home.html":    {Data: []byte(`<h1>{{ partial("partials/name.html", {name: name}) }}</h1>`), ModTime: modTime},
+		"partials/name.html": {Data: []byte(`Hello {{ name }}`), ModTime: modTime},
+	}
+
+	engine := NewEngine(NoEscape, WithReload(dir, ".html"))
+	err := engine.AutoRegister(dir, "", ".html")
+	require.NoError(t, err)
+
+	out, err := engine.RenderToString("pages/home.html", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello Fox</h1>", out)
+
+	// Files are only reloaded when their modification time changes
+	dir["partials/name.html"].Data = []byte(`Goodbye {{ name }}`)
+	out, err = engine.RenderToString("pages/home.html", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello Fox</h1>", out)
+
+	dir["partials/name.html"].ModTime = modTime.Add(time.Second)
+	out, err = engine.RenderToString("pages/home.html", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Goodbye Fox</h1>", out)
+
+	// Templates that aren't registered aren't loaded
+	dir["pages/about.html"] = &fstest.MapFile{Data: []byte(`About {{ name }}`), ModTime: modTime}
+	_, err = engine.RenderToString("pages/about.html", map[string]any{"name": "Fox"})
+	require.ErrorContains(t, err, "template pages/about.html not found")
+
+	// Templates without a file are rendered as registered
+	engine.MustRegister("inline.html", `Inline {{ name }}`)
+	out, err = engine.RenderToString("inline.html", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "Inline Fox", out)
+
+	dir["pages/home.html"].Data = []byte(`{{ name`)
+	dir["pages/home.html"].ModTime = modTime.Add(time.Second)
+	_, err = engine.RenderToString("pages/home.html", map[string]any{"name": "Fox"})
+	require.ErrorContains(t, err, "could not reload template pages/home.html: could not create template: unclosed {{ opened on line 1")
+}
+
+func TestEngine_WithReload_Deregistered(t *testing.T) {
+	modTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	dir := fstest.MapFS{
+		"home.html": {Data: []byte(`Hello {{ name }}`), ModTime: modTime},
+	}
+
+	engine := NewEngine(NoEscape, WithReload(dir, ".html"))
+	err := engine.AutoRegister(dir, "", ".html")
+	require.NoError(t, err)
+
+	require.True(t, engine.Deregister("home.html"))
+
+	dir["home.html"].ModTime = modTime.Add(time.Second)
+	_, err = engine.RenderToString("home.html", map[string]any{"name": "Fox"})
+	require.ErrorContains(t, err, "template home.html not found")
+	require.False(t, engine.Exists("home.html"))
+}
+
+func TestEngine_WithoutReload(t *testing.T) {
+	dir := fstest.MapFS{
+		"home.html": {Data: []byte(`Hello {{ name }}`), ModTime: time.Now()},
+	}
+
+	engine := NewEngine(NoEscape)
+	err := engine.AutoRegister(dir, "", ".html")
+	require.NoError(t, err)
+
+	dir["home.html"].Data = []byte(`Goodbye {{ name }}`)
+	dir["home.html"].ModTime = time.Now().Add(time.Minute)
+
+	out, err := engine.RenderToString("home.html", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "Hello Fox", out)
+}
+
+func TestEngine_RegisterGlob(t *testing.T) {
+	dir := fstest.MapFS{
+		"templates/home.html":              {Data: []byte(`home`)},
+		"templates/users/show.html":        {Data: []byte(`show`)},
+		"templates/users/admin/index.html": {Data: []byte(`admin`)},
+		"templates/users/show.txt":         {Data: []byte(`text`)},
+		"emails/welcome.html":              {Data: []byte(`welcome`)},
+	}
+
+	testCases := map[string]struct {
+		pattern  string
+		expected []string
+	}{
+		"single directory": {pattern: "templates/*.html", expected: []string{"templates/home.html"}},
+		"recursive": {pattern: "templates/**/*.html", expected: []string{
+			"templates/home.html",
+			"templates/users/admin/index.html",
+			"templates/users/show.html",
+		}},
+		"nested": {pattern: "templates/users/*", expected: []string{"templates/users/show.html", "templates/users/show.txt"}},
+		"none":   {pattern: "layouts/*.html", expected: []string{}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			engine := NewEngine(NoEscape)
+			err := engine.RegisterGlob(dir, tc.pattern)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, engine.List())
+		})
+	}
+
+	engine := NewEngine(NoEscape)
+	err := engine.RegisterGlob(fixtures, "**/hello.html")
+	require.NoError(t, err)
+
+	out, err := engine.RenderToString("fixtures/users/hello.html", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello Fox</h1>\n", out)
+}
+
+func TestEngine_RegisterGlob_Errors(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.RegisterGlob(fstest.MapFS{}, "templates/[")
+	require.ErrorContains(t, err, "invalid pattern templates/[")
+
+	err = engine.RegisterGlob(fstest.MapFS{"broken.html": {Data: []byte(`{{ name`)}}, "*.html")
+	require.ErrorContains(t, err, "could not register templates matching *.html: could not register template broken.html")
+}
+
+func TestEngine_RegisterWithOptions(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("page.html", `<p>{{ name }}</p>`)
+
+	err := engine.RegisterWithOptions("email.txt", `Hi {{ name }}`, WithEscapeFunc(NoEscape))
+	require.NoError(t, err)
+
+	data := map[string]any{"name": "<Fox>"}
+
+	out, err := engine.RenderToString("page.html", data)
+	require.NoError(t, err)
+	require.Equal(t, "<p>&lt;Fox&gt;</p>", out)
+
+	out, err = engine.RenderToString("email.txt", data)
+	require.NoError(t, err)
+	require.Equal(t, "Hi <Fox>", out)
+
+	// Options are kept when the template is reloaded
+	err = engine.Reload("email.txt", `Bye {{ name }}`)
+	require.NoError(t, err)
+
+	out, err = engine.RenderToString("email.txt", data)
+	require.NoError(t, err)
+	require.Equal(t, "Bye <Fox>", out)
+
+	// Registering without options removes them
+	engine.MustRegister("email.txt", `Hi {{ name }}`)
+	err = engine.Reload("email.txt", `Bye {{ name }}`)
+	require.NoError(t, err)
+
+	out, err = engine.RenderToString("email.txt", data)
+	require.NoError(t, err)
+	require.Equal(t, "Bye &lt;Fox&gt;", out)
+}
+
+func TestEngine_RegisterWithOptions_EscapingHelpers(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("layout.txt", `{{ yield "head" }}|{{ ChildContent }}`)
+
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"wrap":       {template: `{{ wrap(name, "[", "]") }}`, expected: "[<Fox>]"},
+		"join":       {template: `{{ join([safe("<b>"), name], ", ") }}`, expected: "<b>, <Fox>"},
+		"debug":      {template: `{{ debug(name) }}`, expected: `"<Fox>"`},
+		"contentFor": {template: `{{ layout("layout.txt") }}{{ contentFor("head", name) }}body`, expected: "<Fox>|body"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := engine.RegisterWithOptions("email.txt", tc.template, WithEscapeFunc(NoEscape))
+			require.NoError(t, err)
+
+			out, err := engine.RenderToString("email.txt", map[string]any{"name": "<Fox>"})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	// The engine's escape function is still used by other templates
+	engine.MustRegister("page.html", `{{ wrap(name, "<b>", "</b>") }}`)
+
+	out, err := engine.RenderToString("page.html", map[string]any{"name": "<Fox>"})
+	require.NoError(t, err)
+	require.Equal(t, "<b>&lt;Fox&gt;</b>", out)
+}
+
+func TestEngine_RequireData(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("page", `<h1>{{ title }}</h1>{{ partial("count", {count: count}) }}`)
+	engine.MustRegister("count", `{{ count }}`)
+
+	engine.RequireData("page", map[string]reflect.Kind{"title": reflect.String, "count": reflect.Int})
+	engine.RequireData("count", map[string]reflect.Kind{"count": reflect.Int})
+
+	out, err := engine.RenderToString("page", map[string]any{"title": "Hello", "count": 2})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello</h1>2", out)
+
+	// Safe values are strings
+	_, err = engine.RenderToString("page", map[string]any{"title": Safe("Hello"), "count": 2, "extra": true})
+	require.NoError(t, err)
+
+	_, err = engine.RenderToString("page", map[string]any{"count": "2"})
+	require.EqualError(t, err, "invalid data for template page: 'count' must be int, got string, missing 'title'")
+
+	_, err = engine.RenderToString("page", map[string]any{"title": nil, "count": 2})
+	require.EqualError(t, err, "invalid data for template page: 'title' must be string, got nil")
+
+	// Partials are checked too
+	engine.RequireData("page", nil)
+	_, err = engine.RenderToString("page", map[string]any{"title": "Hello", "count": int64(2)})
+	require.ErrorContains(t, err, "invalid data for template count: 'count' must be int, got int64")
+
+	// Requirements are kept when the template is registered again
+	engine.MustRegister("count", `{{ count }}!`)
+	_, err = engine.RenderToString("count", nil)
+	require.EqualError(t, err, "invalid data for template count: missing 'count'")
+}
+
+func TestEngine_AutoRegisterWithTransform(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.AutoRegisterWithTransform(fixtures, ".html", func(path string) string {
+		return "/" + strings.TrimSuffix(strings.TrimPrefix(path, "fixtures/"), ".html")
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"/home", "/users/hello"}, engine.List())
+
+	out, err := engine.RenderToString("/users/hello", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Hello Fox</h1>\n", out)
+}
+
+func TestEngine_AutoRegisterWithEscaping(t *testing.T) {
+	dir := fstest.MapFS{
+		"templates/welcome.html":     {Data: []byte(`<p>{{ name }}</p>`)},
+		"templates/welcome.txt":      {Data: []byte(`Hi {{ name }}`)},
+		"templates/welcome.html.txt": {Data: []byte(`Raw {{ name }}`)},
+		"templates/signature.txt":    {Data: []byte(`{{ wrap(name, "-- ", "") }}`)},
+		"templates/app.js":           {Data: []byte(`alert({{ name }})`)},
+	}
+
+	engine := NewEngine(HTMLEscape)
+	err := engine.AutoRegisterWithEscaping(dir, "templates", map[string]func(string) string{
+		".html":     HTMLEscape,
+		".txt":      NoEscape,
+		".html.txt": func(s string) string { return "[" + s + "]" },
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"signature.txt", "welcome.html", "welcome.html.txt", "welcome.txt"}, engine.List())
+
+	data := map[string]any{"name": "<Fox>"}
+
+	out, err := engine.RenderToString("welcome.html", data)
+	require.NoError(t, err)
+	require.Equal(t, "<p>&lt;Fox&gt;</p>", out)
+
+	out, err = engine.RenderToString("welcome.txt", data)
+	require.NoError(t, err)
+	require.Equal(t, "Hi <Fox>", out)
+
+	out, err = engine.RenderToString("welcome.html.txt", data)
+	require.NoError(t, err)
+	require.Equal(t, "Raw [<Fox>]", out)
+
+	// Helpers escape using the template's escape function too
+	out, err = engine.RenderToString("signature.txt", data)
+	require.NoError(t, err)
+	require.Equal(t, "-- <Fox>", out)
+}
+
+func TestEngine_AutoRegisterExtensions(t *testing.T) {
+	dir := fstest.MapFS{
+		"templates/welcome.html": {Data: []byte(`<p>{{ name }}</p>`)},
+		"templates/email.txt":    {Data: []byte(`Hi {{ name }}`)},
+		"templates/app.js":       {Data: []byte(`alert({{ name }})`)},
+	}
+
+	engine := NewEngine(NoEscape)
+	err := engine.AutoRegisterExtensions(dir, "templates/", ".html", ".txt")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"email.txt", "welcome.html"}, engine.List())
+
+	out, err := engine.RenderToString("welcome.html", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<p>Fox</p>", out)
+
+	out, err = engine.RenderToString("email.txt", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "Hi Fox", out)
+}
+
 func TestEngine_EscapesHTML(t *testing.T) {
 	engine := NewEngine(HTMLEscape)
 
-	err := engine.Register("foo", "{{\"<h1>hi</h1>\"}}")
+	err := engine.Register("foo", "{{\"<h1>hi</h1>\"}}")
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "foo", map[string]any{})
+	require.NoError(t, err)
+
+	require.Equal(t, "<h1>hi</h1>", b.String())
+}
+
+func TestEngine_DefaultHelper_Safe(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("foo", "{{safe(\"<h1>hi</h1>\")}}")
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "foo", map[string]any{})
+	require.NoError(t, err)
+
+	require.Equal(t, "<h1>hi</h1>", b.String())
+}
+
+func TestEngine_DefaultHelper_URLEncode(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+
+	err := engine.Register("foo", `<a href="/search?q={{urlEncode(q)}}">`)
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		q        string
+		expected string
+	}{
+		"spaces":  {q: "fox mulder", expected: `<a href="/search?q=fox+mulder">`},
+		"special": {q: `a&b=c/d?"<e>`, expected: `<a href="/search?q=a%26b%3Dc%2Fd%3F%22%3Ce%3E">`},
+		"unicode": {q: "café ☕", expected: `<a href="/search?q=caf%C3%A9+%E2%98%95">`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			err = engine.Render(b, "foo", map[string]any{"q": tc.q})
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestEngine_DefaultHelper_URLPathEscape(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+
+	err := engine.Register("foo", `<a href="/users/{{urlPathEscape(name)}}">`)
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		name     string
+		expected string
+	}{
+		"spaces":  {name: "fox mulder", expected: `<a href="/users/fox%20mulder">`},
+		"special": {name: `a/b?c&d"<e>`, expected: `<a href="/users/a%2Fb%3Fc&d%22%3Ce%3E">`},
+		"unicode": {name: "café ☕", expected: `<a href="/users/caf%C3%A9%20%E2%98%95">`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			err = engine.Render(b, "foo", map[string]any{"name": tc.name})
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestEngine_DefaultHelper_ToJSON(t *testing.T) {
+	type payload struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("json", `<script>var data = {{toJSON(value)}}</script>`)
+
+	testCases := map[string]struct {
+		value    any
+		expected string
+	}{
+		"struct": {value: payload{Name: "Fox", Count: 1}, expected: `<script>var data = {"name":"Fox","count":1}</script>`},
+		"map":    {value: map[string]any{"b": 2, "a": "</script>"}, expected: `<script>var data = {"a":"\u003c/script\u003e","b":2}</script>`},
+		"slice":  {value: []int{1, 2, 3}, expected: `<script>var data = [1,2,3]</script>`},
+		"nil":    {value: nil, expected: `<script>var data = null</script>`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := engine.RenderToString("json", map[string]any{"value": tc.value})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	engine.MustRegister("invalid", "<script>\nvar data = {{toJSON(value)}}\n</script>")
+	_, err := engine.RenderToString("invalid", map[string]any{"value": map[string]any{"fn": func() {}}})
+	require.ErrorContains(t, err, "error calling function 'toJSON': could not convert map[string]interface {} to JSON: json: unsupported type: func()")
+	require.ErrorContains(t, err, "on line 2")
+}
+
+func TestEngine_DefaultHelper_ToJSONPretty(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("json", `{{toJSONPretty(value)}}`)
+
+	out, err := engine.RenderToString("json", map[string]any{"value": map[string]any{"names": []string{"Fox"}}})
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"names\": [\n    \"Fox\"\n  ]\n}", out)
+
+	_, err = engine.RenderToString("json", map[string]any{"value": make(chan int)})
+	require.ErrorContains(t, err, "could not convert chan int to JSON")
+}
+
+func TestEngine_DefaultHelper_Len(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("foo", `{{len("some value")}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "foo", map[string]any{})
+	require.NoError(t, err)
+
+	require.Equal(t, "10", b.String())
+}
+
+func TestEngine_DefaultHelper_Partial(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("hello", "{{name}}")
+	require.NoError(t, err)
+	err = engine.Register("foo", `Hi {{partial("hello", {name: name})}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "foo", map[string]any{"name": "Fox Mulder"})
+	require.NoError(t, err)
+
+	require.Equal(t, "Hi Fox Mulder", b.String())
+}
+
+func TestEngine_DefaultHelper_Partial_NestedMap(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	engine.MustRegister("card", `{{user.name}} ({{user.age}}) {{user.tags[0].label}}`)
+	engine.MustRegister("page", `{{ partial("card", {user: {name: Name, age: Age, tags: [{label: "agent"}]}}) }}`)
+
+	out, err := engine.RenderToString("page", map[string]any{"Name": "Fox Mulder", "Age": 33})
+	require.NoError(t, err)
+
+	require.Equal(t, "Fox Mulder (33) agent", out)
+}
+
+func TestEngine_DefaultHelper_UID(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	engine.MustRegister("field", `<input id="{{uid("field")}}">`)
+	engine.MustRegister("form", `{{uid("field")}} {{uid("form")}} {{partial("field", {})}} {{uid("field")}}`)
+
+	out, err := engine.RenderToString("form", map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, `field-1 form-1 <input id="field-2"> field-3`, out)
+
+	out, err = engine.RenderToString("form", map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, `field-1 form-1 <input id="field-2"> field-3`, out)
+}
+
+func TestEngine_DefaultHelper_Sanitize(t *testing.T) {
+	sanitizer := func(s string) string {
+		return strings.ReplaceAll(s, "<script>", "")
+	}
+	engine := NewEngine(HTMLEscape, WithSanitizer(sanitizer))
+	engine.MustRegister("comment", `<p>{{sanitize(body)}}</p>`)
+
+	out, err := engine.RenderToString("comment", map[string]any{"body": "<b>hi</b><script>"})
+	require.NoError(t, err)
+	require.Equal(t, "<p><b>hi</b></p>", out)
+}
+
+func TestEngine_DefaultHelper_Sanitize_Missing(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("comment", `<p>{{sanitize(body)}}</p>`)
+
+	_, err := engine.RenderToString("comment", map[string]any{"body": "<b>hi</b>"})
+	require.ErrorContains(t, err, "sanitize called without a sanitizer, provide one using WithSanitizer")
+}
+
+func TestEngine_DefaultHelper_FieldTag(t *testing.T) {
+	type signup struct {
+		Email string `json:"email" form:"user[email]"`
+		Name  string
+	}
+
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("form", `{{fieldTag(form, "Email", "json")}} {{fieldTag(form, "Email", "form")}} [{{fieldTag(form, "Name", "json")}}]`)
+
+	out, err := engine.RenderToString("form", map[string]any{"form": signup{}})
+	require.NoError(t, err)
+	require.Equal(t, "email user[email] []", out)
+
+	out, err = engine.RenderToString("form", map[string]any{"form": &signup{}})
+	require.NoError(t, err)
+	require.Equal(t, "email user[email] []", out)
+
+	engine.MustRegister("missing", `{{fieldTag(form, "Phone", "json")}}`)
+	_, err = engine.RenderToString("missing", map[string]any{"form": signup{}})
+	require.ErrorContains(t, err, "no field 'Phone' for type bat.signup")
+
+	_, err = engine.RenderToString("form", map[string]any{"form": "signup"})
+	require.ErrorContains(t, err, "fieldTag expects a struct, got string")
+}
+
+func TestEngine_DefaultHelper_Entries(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("scores", `{{range $i, $e in entries(scores)}}{{$e.Key}}:{{$e.Value}} {{end}}`)
+
+	out, err := engine.RenderToString("scores", map[string]any{"scores": map[string]int{"c": 3, "a": 1, "b": 2}})
+	require.NoError(t, err)
+	require.Equal(t, "a:1 b:2 c:3 ", out)
+
+	_, err = engine.RenderToString("scores", map[string]any{"scores": []int{1}})
+	require.ErrorContains(t, err, "entries expects a map, got []int")
+}
+
+func TestEngine_DefaultHelper_Upper(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("upper", `{{upper(name)}} {{upper(safe(name))}}`)
+
+	out, err := engine.RenderToString("upper", map[string]any{"name": "<b>Fox</b>"})
+	require.NoError(t, err)
+	require.Equal(t, "&lt;B&gt;FOX&lt;/B&gt; <B>FOX</B>", out)
+
+	_, err = engine.RenderToString("upper", map[string]any{"name": 1})
+	require.ErrorContains(t, err, "upper expects a string, got int")
+}
+
+func TestEngine_DefaultHelper_Lower(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("lower", `{{lower(name)}} {{lower(safe(name))}}`)
+
+	out, err := engine.RenderToString("lower", map[string]any{"name": "<B>Fox</B>"})
+	require.NoError(t, err)
+	require.Equal(t, "&lt;b&gt;fox&lt;/b&gt; <b>fox</b>", out)
+}
+
+func TestEngine_DefaultHelper_Title(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("title", `{{title(name)}} {{title(safe(name))}}`)
+
+	out, err := engine.RenderToString("title", map[string]any{"name": "<i>fox</i>"})
+	require.NoError(t, err)
+	require.Equal(t, "&lt;I&gt;FOX&lt;/I&gt; <I>FOX</I>", out)
+}
+
+func TestEngine_DefaultHelper_Trim(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("trim", `[{{trim(name)}}] [{{trim(safe(name))}}]`)
+
+	out, err := engine.RenderToString("trim", map[string]any{"name": "  <b>Fox</b>\n"})
+	require.NoError(t, err)
+	require.Equal(t, "[&lt;b&gt;Fox&lt;/b&gt;] [<b>Fox</b>]", out)
+}
+
+func TestEngine_DefaultHelper_TrimLeft(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("trimLeft", `{{trimLeft(path, "/")}} {{trimLeft(safe(path), "/")}}`)
+
+	out, err := engine.RenderToString("trimLeft", map[string]any{"path": "//<b>/"})
+	require.NoError(t, err)
+	require.Equal(t, "&lt;b&gt;/ <b>/", out)
+}
+
+func TestEngine_DefaultHelper_TrimRight(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("trimRight", `{{trimRight(path, "/")}} {{trimRight(safe(path), "/")}}`)
+
+	out, err := engine.RenderToString("trimRight", map[string]any{"path": "/<b>//"})
+	require.NoError(t, err)
+	require.Equal(t, "/&lt;b&gt; /<b>", out)
+}
+
+func TestEngine_DefaultHelper_Replace(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("replace", `{{replace(name, "b", "i")}} {{replace(safe(name), "b", "i")}}`)
+
+	out, err := engine.RenderToString("replace", map[string]any{"name": "<b>Fox</b>"})
+	require.NoError(t, err)
+	require.Equal(t, "&lt;i&gt;Fox&lt;/i&gt; <i>Fox</i>", out)
+}
+
+func TestEngine_DefaultHelper_Split(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("split", `{{range $i, $part in split(csv, sep)}}[{{$part}}]{{end}}`)
+
+	out, err := engine.RenderToString("split", map[string]any{"csv": "a,b,,c", "sep": ","})
+	require.NoError(t, err)
+	require.Equal(t, "[a][b][][c]", out)
+
+	// An empty separator splits after each character
+	out, err = engine.RenderToString("split", map[string]any{"csv": "abc", "sep": ""})
+	require.NoError(t, err)
+	require.Equal(t, "[a][b][c]", out)
+}
+
+func TestEngine_DefaultHelper_Join(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("join", `{{join(names, ", ")}}`)
+
+	out, err := engine.RenderToString("join", map[string]any{"names": []string{"Fox", "<Dana>"}})
+	require.NoError(t, err)
+	require.Equal(t, "Fox, &lt;Dana&gt;", out)
+
+	out, err = engine.RenderToString("join", map[string]any{"names": []any{Safe("<b>Fox</b>"), "<Dana>", 1}})
+	require.NoError(t, err)
+	require.Equal(t, "<b>Fox</b>, &lt;Dana&gt;, 1", out)
+
+	engine.MustRegister("joinSplit", `{{join(split(csv, ","), " | ")}}`)
+	out, err = engine.RenderToString("joinSplit", map[string]any{"csv": "a,b"})
+	require.NoError(t, err)
+	require.Equal(t, "a | b", out)
+
+	_, err = engine.RenderToString("join", map[string]any{"names": "Fox"})
+	require.ErrorContains(t, err, "join expects a slice, got string")
+}
+
+func TestEngine_DefaultHelper_Default(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("default", `{{default(value, "fallback")}}`)
+	engine.MustRegister("defaultNil", `{{defaultNil(value, "fallback")}}`)
+
+	testCases := map[string]struct {
+		value      any
+		def        string
+		defaultNil string
+	}{
+		"missing":     {value: nil, def: "fallback", defaultNil: "fallback"},
+		"nil pointer": {value: (*user)(nil), def: "fallback", defaultNil: "fallback"},
+		"zero int":    {value: 0, def: "fallback", defaultNil: "0"},
+		"empty":       {value: "", def: "fallback", defaultNil: ""},
+		"false":       {value: false, def: "fallback", defaultNil: "false"},
+		"int":         {value: 42, def: "42", defaultNil: "42"},
+		"string":      {value: "Fox", def: "Fox", defaultNil: "Fox"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data := map[string]any{"value": tc.value}
+
+			out, err := engine.RenderToString("default", data)
+			require.NoError(t, err)
+			require.Equal(t, tc.def, out)
+
+			out, err = engine.RenderToString("defaultNil", data)
+			require.NoError(t, err)
+			require.Equal(t, tc.defaultNil, out)
+		})
+	}
+}
+
+func TestEngine_DefaultHelper_Keys(t *testing.T) {
+	type profile struct {
+		Name   string
+		Age    int
+		secret string
+	}
+
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("keys", `{{range $i, $k in keys(value)}}{{$k}} {{end}}`)
+
+	out, err := engine.RenderToString("keys", map[string]any{"value": map[string]int{"c": 3, "a": 1, "b": 2}})
+	require.NoError(t, err)
+	require.Equal(t, "a b c ", out)
+
+	out, err = engine.RenderToString("keys", map[string]any{"value": &profile{Name: "Fox", Age: 42, secret: "x"}})
+	require.NoError(t, err)
+	require.Equal(t, "Name Age ", out)
+
+	_, err = engine.RenderToString("keys", map[string]any{"value": []int{1}})
+	require.ErrorContains(t, err, "keys expects a map or struct, got []int")
+}
+
+func TestEngine_DefaultHelper_Values(t *testing.T) {
+	type profile struct {
+		Name   string
+		Age    int
+		secret string
+	}
+
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("values", `{{range $i, $v in values(value)}}{{$v}} {{end}}`)
+
+	out, err := engine.RenderToString("values", map[string]any{"value": map[string]int{"c": 3, "a": 1, "b": 2}})
+	require.NoError(t, err)
+	require.Equal(t, "1 2 3 ", out)
+
+	out, err = engine.RenderToString("values", map[string]any{"value": profile{Name: "Fox", Age: 42, secret: "x"}})
+	require.NoError(t, err)
+	require.Equal(t, "Fox 42 ", out)
+
+	_, err = engine.RenderToString("values", map[string]any{"value": "Fox"})
+	require.ErrorContains(t, err, "values expects a map or struct, got string")
+}
+
+func TestEngine_DefaultHelper_FirstLastNth(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("first", `{{first(items) ?? "none"}}`)
+	engine.MustRegister("last", `{{last(items) ?? "none"}}`)
+	engine.MustRegister("nth", `{{nth(items, 1) ?? "none"}}`)
+	engine.MustRegister("split", `{{first(split(value, ","))}} {{last(split(value, ","))}} {{nth(split(value, ","), 5) ?? "none"}}`)
+
+	testCases := map[string]struct {
+		items any
+		first string
+		last  string
+		nth   string
+	}{
+		"empty":  {items: []string{}, first: "none", last: "none", nth: "none"},
+		"nil":    {items: nil, first: "none", last: "none", nth: "none"},
+		"single": {items: []string{"Fox"}, first: "Fox", last: "Fox", nth: "none"},
+		"many":   {items: []int{1, 2, 3}, first: "1", last: "3", nth: "2"},
+		"array":  {items: [2]string{"Fox", "Dana"}, first: "Fox", last: "Dana", nth: "Dana"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data := map[string]any{"items": tc.items}
+
+			out, err := engine.RenderToString("first", data)
+			require.NoError(t, err)
+			require.Equal(t, tc.first, out)
+
+			out, err = engine.RenderToString("last", data)
+			require.NoError(t, err)
+			require.Equal(t, tc.last, out)
+
+			out, err = engine.RenderToString("nth", data)
+			require.NoError(t, err)
+			require.Equal(t, tc.nth, out)
+		})
+	}
+
+	out, err := engine.RenderToString("split", map[string]any{"value": "a,b,c"})
+	require.NoError(t, err)
+	require.Equal(t, "a c none", out)
+
+	_, err = engine.RenderToString("first", map[string]any{"items": "Fox"})
+	require.ErrorContains(t, err, "first expects a slice, got string")
+}
+
+func TestEngine_DefaultHelper_Contains(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("contains", `{{contains(collection, item)}}`)
+
+	testCases := map[string]struct {
+		collection any
+		item       any
+		expected   string
+	}{
+		"string":           {collection: "this is important", item: "important", expected: "true"},
+		"missing string":   {collection: "this is important", item: "urgent", expected: "false"},
+		"slice":            {collection: []string{"news", "featured"}, item: "featured", expected: "true"},
+		"missing in slice": {collection: []string{"news"}, item: "featured", expected: "false"},
+		"converted":        {collection: []int64{1, 2, 3}, item: 2, expected: "true"},
+		"array":            {collection: [2]string{"a", "b"}, item: "b", expected: "true"},
+		"map":              {collection: map[string]int{"theme": 1}, item: "theme", expected: "true"},
+		"missing key":      {collection: map[string]int{"theme": 1}, item: "font", expected: "false"},
+		"nil":              {collection: nil, item: "featured", expected: "false"},
+		"nil slice":        {collection: []string(nil), item: "featured", expected: "false"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := engine.RenderToString("contains", map[string]any{"collection": tc.collection, "item": tc.item})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	_, err := engine.RenderToString("contains", map[string]any{"collection": 42, "item": 4})
+	require.ErrorContains(t, err, "can't check membership in int")
+}
+
+func TestEngine_DefaultHelper_ToBool(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("toBool", `{{if toBool(value)}}on{{else}}off{{end}}`)
+
+	testCases := map[string]string{
+		"true":   "on",
+		"1":      "on",
+		"yes":    "on",
+		" YES\n": "on",
+		"True":   "on",
+		"false":  "off",
+		"0":      "off",
+		"no":     "off",
+		"No":     "off",
+	}
+
+	for value, expected := range testCases {
+		t.Run(value, func(t *testing.T) {
+			out, err := engine.RenderToString("toBool", map[string]any{"value": value})
+			require.NoError(t, err)
+			require.Equal(t, expected, out)
+		})
+	}
+
+	_, err := engine.RenderToString("toBool", map[string]any{"value": "maybe"})
+	require.ErrorContains(t, err, `toBool can't convert "maybe" to a bool`)
+}
+
+func TestEngine_DefaultHelper_Bitor(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("bitor", `{{bitor(flags, mask)}}`)
+
+	testCases := map[string]struct {
+		flags    any
+		mask     any
+		expected string
+	}{
+		"ints":       {flags: 1, mask: 2, expected: "3"},
+		"overlap":    {flags: 6, mask: 3, expected: "7"},
+		"uint":       {flags: 1, mask: uint8(0xF0), expected: "241"},
+		"zero":       {flags: 0, mask: 0, expected: "0"},
+		"negative":   {flags: -2, mask: 1, expected: "-1"},
+		"mixed ints": {flags: int64(8), mask: 1, expected: "9"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := engine.RenderToString("bitor", map[string]any{"flags": tc.flags, "mask": tc.mask})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	_, err := engine.RenderToString("bitor", map[string]any{"flags": 1.5, "mask": 1})
+	require.ErrorContains(t, err, "can't use | on float64 and int, both must be integers")
+}
+
+func TestEngine_DefaultHelper_IntFloat(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	err := engine.RegisterWithOptions("cart", `{{ float(quantity) * price }} {{ int(id) + quantity }} {{ int(price) }}`, WithStrictArithmetic())
+	require.NoError(t, err)
+
+	out, err := engine.RenderToString("cart", map[string]any{"quantity": 3, "price": 1.5, "id": int64(2)})
+	require.NoError(t, err)
+	require.Equal(t, "4.5 5 1", out)
+
+	engine.MustRegister("int", `{{ int(value) }}`)
+	_, err = engine.RenderToString("int", map[string]any{"value": "1"})
+	require.ErrorContains(t, err, "int can't convert string to an int")
+
+	engine.MustRegister("float", `{{ float(value) }}`)
+	_, err = engine.RenderToString("float", map[string]any{"value": nil})
+	require.ErrorContains(t, err, "float can't convert <nil> to a float")
+}
+
+func TestEngine_DefaultHelper_FirstLastNth_StrictMode(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	require.NoError(t, engine.RegisterWithOptions("first", `{{first(items)}}`, WithStrictMode()))
+	require.NoError(t, engine.RegisterWithOptions("last", `{{last(items)}}`, WithStrictMode()))
+	require.NoError(t, engine.RegisterWithOptions("nth", `{{nth(items, n)}}`, WithStrictMode()))
+
+	testCases := map[string]struct {
+		template string
+		data     map[string]any
+		expected string
+		err      string
+	}{
+		"first":        {template: "first", data: map[string]any{"items": []int{1, 2}}, expected: "1"},
+		"first empty":  {template: "first", data: map[string]any{"items": []int{}}, err: "first index 0 out of range for length 0"},
+		"first nil":    {template: "first", data: map[string]any{"items": nil}, err: "first expects a slice, got nil"},
+		"last":         {template: "last", data: map[string]any{"items": []int{1, 2}}, expected: "2"},
+		"last empty":   {template: "last", data: map[string]any{"items": []string{}}, err: "last index -1 out of range for length 0"},
+		"nth":          {template: "nth", data: map[string]any{"items": []int{1, 2}, "n": 1}, expected: "2"},
+		"nth too big":  {template: "nth", data: map[string]any{"items": []int{1, 2}, "n": 2}, err: "nth index 2 out of range for length 2"},
+		"nth negative": {template: "nth", data: map[string]any{"items": []int{1, 2}, "n": -1}, err: "nth index must not be negative, got -1"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := engine.RenderToString(tc.template, tc.data)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	// Templates without strict mode still render nil
+	engine.MustRegister("lenient", `{{first(items) ?? "none"}}`)
+
+	out, err := engine.RenderToString("lenient", map[string]any{"items": []int{}})
+	require.NoError(t, err)
+	require.Equal(t, "none", out)
+}
+
+func TestEngine_DefaultHelper_Chunk(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("grid", `{{range $i, $row in chunk(items, 3)}}<tr>{{range $j, $cell in $row}}<td>{{$cell}}</td>{{end}}</tr>{{end}}`)
+
+	testCases := map[string]struct {
+		items    any
+		expected string
+	}{
+		"even":   {items: []int{1, 2, 3, 4, 5, 6}, expected: "<tr><td>1</td><td>2</td><td>3</td></tr><tr><td>4</td><td>5</td><td>6</td></tr>"},
+		"uneven": {items: []string{"a", "b", "c", "d"}, expected: "<tr><td>a</td><td>b</td><td>c</td></tr><tr><td>d</td></tr>"},
+		"short":  {items: [2]int{1, 2}, expected: "<tr><td>1</td><td>2</td></tr>"},
+		"empty":  {items: []int{}, expected: ""},
+		"nil":    {items: nil, expected: ""},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, err := engine.RenderToString("grid", map[string]any{"items": tc.items})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	engine.MustRegister("size", `{{chunk(items, size)}}`)
+
+	_, err := engine.RenderToString("size", map[string]any{"items": []int{1}, "size": 0})
+	require.ErrorContains(t, err, "chunk size must be greater than 0, got 0")
+
+	_, err = engine.RenderToString("size", map[string]any{"items": "abc", "size": 2})
+	require.ErrorContains(t, err, "chunk expects a slice, got string")
+}
+
+func TestEngine_Errors(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("hello", "{{name[0]}}")
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	require.Error(t, err)
+	require.ErrorContains(t, err, "starting on line 1")
+	require.ErrorContains(t, err, "{{name[0]}}")
+}
+
+func TestEngine_Render_PartialHelpers(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.Helper("shout", func(s string) string { return s + "!" })
+	engine.Helper("whisper", func(s string) string { return "(" + s + ")" })
+
+	engine.MustRegister("label", `<span>{{ format(text) }}</span>`)
+	engine.MustRegister(
+		"page",
+		`{{ partial("label", {text: "a"}, {format: shout}) }}{{ partial("label", {text: "b"}, {format: whisper}) }}{{ format("c") }}`,
+	)
+
+	out, err := engine.RenderWithHelpersToString("page", map[string]any{"format": func(s string) string { return s }}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "<span>a!</span><span>(b)</span>c", out)
+
+	engine.MustRegister("invalid", `{{ partial("label", {}, {}, {}) }}`)
+	_, err = engine.RenderToString("invalid", nil)
+	require.ErrorContains(t, err, "partial accepts at most 1 map of helpers, got 2")
+}
+
+func TestEngine_Render_Layout(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("layout", `<h1>HELLO {{ ChildContent }}!</h1>`)
+	require.NoError(t, err)
+	err = engine.Register("hello", `{{ layout("layout") }}{{ name }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	require.NoError(t, err)
+
+	require.Equal(t, "<h1>HELLO Fox Mulder!</h1>", b.String())
+}
+
+func TestEngine_Render_Nested_Layout(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("root", "<html>{{ ChildContent }}</html>")
+	require.NoError(t, err)
+	err = engine.Register("layout", `{{ layout("root") }}<h1>HELLO {{ ChildContent }}!</h1>`)
+	require.NoError(t, err)
+	err = engine.Register("hello", `{{ layout("layout") }}{{ name }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	require.NoError(t, err)
+
+	require.Equal(t, "<html><h1>HELLO Fox Mulder!</h1></html>", b.String())
+}
+
+func TestEngine_Render_Layout_Slots(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+
+	err := engine.Register("layout", `<main>{{ yield }}</main>{{ yield "scripts" }}{{ yield("missing") }}`)
+	require.NoError(t, err)
+	err = engine.Register("script", `{{ slot "scripts" }}<script src="{{ src }}"></script>{{ end }}`)
+	require.NoError(t, err)
+	err = engine.Register(
+		"hello",
+		`{{ layout("layout") }}{{ slot "scripts" }}<script src="/app.js"></script>{{ end }}{{ partial("script", {src: "/<b>.js"}) }}{{ name }}`,
+	)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "hello", map[string]any{"name": "<Fox>"})
+	require.NoError(t, err)
+
+	require.Equal(
+		t,
+		`<main>&lt;Fox&gt;</main><script src="/app.js"></script><script src="/&lt;b&gt;.js"></script>`,
+		b.String(),
+	)
+}
+
+func TestEngine_Render_Layout_ContentFor(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	engine.MustRegister("layout", `<aside>{{ yield("sidebar") }}</aside><footer>{{ yield("footer") }}</footer>{{ ChildContent }}`)
+	engine.MustRegister(
+		"hello",
+		`{{ layout("layout") }}{{ contentFor("sidebar") }}<nav>{{ name }}</nav>{{ end }}{{ contentFor("unused") }}ignored{{ end }}<p>Body</p>`,
+	)
+
+	out, err := engine.RenderToString("hello", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<aside><nav>Fox</nav></aside><footer></footer><p>Body</p>", out)
+}
+
+func TestEngine_Render_Layout_ContentForHelper(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+
+	engine.MustRegister("layout", `<head>{{ yield("head") }}</head>[{{ yield("missing") }}]{{ ChildContent }}`)
+	engine.MustRegister("meta", `{{ contentFor("head", safe("<meta name='author'>")) }}`)
+	engine.MustRegister(
+		"hello",
+		`{{ layout("layout") }}{{ contentFor("head", safe("<meta charset='utf-8'>")) }}{{ contentFor("head", title) }}{{ partial("meta", {}) }}<p>Body</p>`,
+	)
+
+	out, err := engine.RenderToString("hello", map[string]any{"title": "<Fox>"})
+	require.NoError(t, err)
+	require.Equal(t, `<head><meta charset='utf-8'>&lt;Fox&gt;<meta name='author'></head>[]<p>Body</p>`, out)
+}
+
+func TestEngine_Render_Layout_Blocks(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+
+	engine.MustRegister("layout", `<title>{{ block "title" }}Default{{ end }}</title><aside>{{ block "sidebar" }}<p>Default</p>{{ end }}</aside>{{ ChildContent }}`)
+	engine.MustRegister("hello", `{{ layout("layout") }}{{ define "title" }}Hello {{ name }}{{ end }}<p>Body</p>`)
+
+	out, err := engine.RenderToString("hello", map[string]any{"name": "<Fox>"})
+	require.NoError(t, err)
+	require.Equal(t, "<title>Hello &lt;Fox&gt;</title><aside><p>Default</p></aside><p>Body</p>", out)
+}
+
+func TestEngine_Render_Nested_Layout_Blocks(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	engine.MustRegister("root", `<title>{{ block "title" }}Root{{ end }}</title><nav>{{ block "nav" }}Root nav{{ end }}</nav>{{ ChildContent }}`)
+	engine.MustRegister(
+		"layout",
+		`{{ layout("root") }}{{ define "title" }}Layout{{ end }}{{ define "nav" }}Layout nav{{ end }}<aside>{{ block "title" }}{{ end }}</aside>{{ ChildContent }}`,
+	)
+	engine.MustRegister("hello", `{{ layout("layout") }}{{ define "title" }}Hello{{ end }}<p>Body</p>`)
+
+	out, err := engine.RenderToString("hello", nil)
+	require.NoError(t, err)
+	require.Equal(t, "<title>Hello</title><nav>Layout nav</nav><aside>Hello</aside><p>Body</p>", out)
+}
+
+func TestEngine_Render_Layout_Args(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	engine.MustRegister("layout", `<title>{{ heading }}</title><h1>{{ name }}</h1>{{ ChildContent }}`)
+	engine.MustRegister("hello", `{{ layout("layout", {heading: "Home", name: "Dana"}) }}<p>{{ name }}</p>[{{ heading }}]`)
+
+	out, err := engine.RenderToString("hello", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "<title>Home</title><h1>Dana</h1><p>Fox</p>[]", out)
+
+	engine.MustRegister("invalid", `{{ layout("layout", {}, {}) }}`)
+	_, err = engine.RenderToString("invalid", nil)
+	require.ErrorContains(t, err, "layout accepts at most 1 map of data, got 2")
+}
+
+func TestEngine_Render_Layout_MultipleCalls(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("layout", `<h1>HELLO {{ ChildContent }}!</h1>`)
+	require.NoError(t, err)
+	err = engine.Register("hello", `{{ layout("layout") }}{{ layout("layout") }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	require.ErrorContains(t, err, "layout already set")
+}
+
+func TestEngine_Render_Layout_Missing(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	err := engine.Register("hello", `{{ layout("layout") }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	require.Error(t, err)
+}
+
+func TestEngine_Render_Layout_InheritsData(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	err := engine.Register("layout", `<{{ Tag }}>HELLO {{ ChildContent }}!</{{ Tag }}>`)
+	require.NoError(t, err)
+	err = engine.Register("hello", `{{ layout("layout") }}{{ name }}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder", "Tag": "h2"})
+	require.NoError(t, err)
+	require.Equal(t, "<h2>HELLO Fox Mulder!</h2>", b.String())
+}
+
+func TestEngine_Render_Nested_LocalHelper(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("root", "<html>{{ ChildContent }}</html>")
+	require.NoError(t, err)
+	err = engine.Register("layout", `{{ layout("root") }}<h1>HELLO {{ ChildContent }}!</h1>`)
+	require.NoError(t, err)
+	err = engine.Register("hello", `{{ layout("layout") }}{{ omg() }}`)
 	require.NoError(t, err)
 
+	helpers := map[string]any{
+		"omg": func() string { return "omg" },
+	}
 	b := new(bytes.Buffer)
-	err = engine.Render(b, "foo", map[string]any{})
+	err = engine.RenderWithHelpers(b, "hello", helpers, map[string]any{"name": "Fox Mulder"})
 	require.NoError(t, err)
 
-	require.Equal(t, "<h1>hi</h1>", b.String())
+	require.Equal(t, "<html><h1>HELLO omg!</h1></html>", b.String())
 }
 
-func TestEngine_DefaultHelper_Safe(t *testing.T) {
+func TestEngine_DefaultHelper_Partial_Helpers(t *testing.T) {
 	engine := NewEngine(NoEscape)
 
-	err := engine.Register("foo", "{{safe(\"<h1>hi</h1>\")}}")
+	err := engine.Register("hello", "{{name}}. {{ omg() }}")
+	require.NoError(t, err)
+	err = engine.Register("foo", `Hi {{partial("hello", {name: name})}}`)
 	require.NoError(t, err)
 
+	helpers := map[string]any{
+		"omg": func() string { return "omg" },
+	}
+
 	b := new(bytes.Buffer)
-	err = engine.Render(b, "foo", map[string]any{})
+	err = engine.RenderWithHelpers(b, "foo", helpers, map[string]any{"name": "Fox Mulder"})
 	require.NoError(t, err)
 
-	require.Equal(t, "<h1>hi</h1>", b.String())
+	require.Equal(t, "Hi Fox Mulder. omg", b.String())
 }
 
-func TestEngine_DefaultHelper_Len(t *testing.T) {
+func TestEngine_Comments(t *testing.T) {
 	engine := NewEngine(NoEscape)
 
-	err := engine.Register("foo", `{{len("some value")}}`)
+	err := engine.Register("hello", "Hello {{ // name }}")
 	require.NoError(t, err)
 
+	helpers := map[string]any{}
+
 	b := new(bytes.Buffer)
-	err = engine.Render(b, "foo", map[string]any{})
+	err = engine.RenderWithHelpers(b, "hello", helpers, map[string]any{"name": "Fox Mulder"})
 	require.NoError(t, err)
 
-	require.Equal(t, "10", b.String())
+	require.Equal(t, "Hello ", b.String())
 }
 
-func TestEngine_DefaultHelper_Partial(t *testing.T) {
+func TestEngine_CommentAfterStatement(t *testing.T) {
 	engine := NewEngine(NoEscape)
 
-	err := engine.Register("hello", "{{name}}")
+	err := engine.Register("hello", "Hello {{ name // Necessary }}")
 	require.NoError(t, err)
-	err = engine.Register("foo", `Hi {{partial("hello", {name: name})}}`)
+
+	helpers := map[string]any{}
+
+	b := new(bytes.Buffer)
+	err = engine.RenderWithHelpers(b, "hello", helpers, map[string]any{"name": "Fox Mulder"})
+	require.NoError(t, err)
+
+	require.Equal(t, "Hello Fox Mulder", b.String())
+}
+
+func TestEngine_DefaultHelper_Debug(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+
+	err := engine.Register("foo", `{{debug(value)}}`)
 	require.NoError(t, err)
 
 	b := new(bytes.Buffer)
-	err = engine.Render(b, "foo", map[string]any{"name": "Fox Mulder"})
+	err = engine.Render(b, "foo", map[string]any{"value": map[string]string{"name": "<b>Fox</b>"}})
 	require.NoError(t, err)
 
-	require.Equal(t, "Hi Fox Mulder", b.String())
+	require.Equal(t, "<pre>map[string]string{\n  &#34;name&#34;: &#34;&lt;b&gt;Fox&lt;/b&gt;&#34;,\n}</pre>", b.String())
 }
 
-func TestEngine_Errors(t *testing.T) {
+func TestEngine_DefaultHelper_Debug_NoEscape(t *testing.T) {
 	engine := NewEngine(NoEscape)
 
-	err := engine.Register("hello", "{{name[0]}}")
+	err := engine.Register("foo", `{{debug(value)}}`)
 	require.NoError(t, err)
 
 	b := new(bytes.Buffer)
-	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
-	require.Error(t, err)
-	require.ErrorContains(t, err, "starting on line 1")
-	require.ErrorContains(t, err, "{{name[0]}}")
+	err = engine.Render(b, "foo", map[string]any{"value": []int{1}})
+	require.NoError(t, err)
+
+	require.Equal(t, "[]int{\n  1,\n}", b.String())
 }
 
-func TestEngine_Render_Layout(t *testing.T) {
+func TestEngine_DefaultHelper_Debug_Disabled(t *testing.T) {
+	engine := NewEngine(HTMLEscape, WithDebugDisabled())
+
+	err := engine.Register("foo", `{{debug(value)}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "foo", map[string]any{"value": "secret"})
+	require.NoError(t, err)
+
+	require.Equal(t, "", b.String())
+}
+
+func TestEngine_DefaultHelper_Wrap(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+
+	err := engine.Register("foo", `<h1>Title</h1>{{ wrap(subtitle, "<p>", "</p>") }}`)
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		subtitle any
+		expected string
+	}{
+		"present": {subtitle: "Fox & Dana", expected: "<h1>Title</h1><p>Fox &amp; Dana</p>"},
+		"safe":    {subtitle: Safe("<b>Fox</b>"), expected: "<h1>Title</h1><p><b>Fox</b></p>"},
+		"number":  {subtitle: 0, expected: "<h1>Title</h1><p>0</p>"},
+		"empty":   {subtitle: "", expected: "<h1>Title</h1>"},
+		"nil":     {subtitle: nil, expected: "<h1>Title</h1>"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			err = engine.Render(b, "foo", map[string]any{"subtitle": tc.subtitle})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, b.String())
+		})
+	}
+}
+
+func TestEngine_DefaultHelper_Currency(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.MustRegister("total", `{{ currency(cents, "USD") }} {{ currency(dollars, "USD") }}`)
+
+	out, err := engine.RenderToString("total", map[string]any{"cents": 123456, "dollars": 1234.56})
+	require.NoError(t, err)
+	require.Equal(t, "$1,234.56 $1,234.56", out)
+}
+
+func TestEngine_DefaultHelper_Env(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("foo", `<p>Hello</p>{{if env("debug")}}<p>debug mode</p>{{end}}`)
+	require.NoError(t, err)
+
+	b := new(bytes.Buffer)
+	err = engine.Render(b, "foo", map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, "<p>Hello</p>", b.String())
+
+	engine.SetEnv(map[string]any{"debug": true})
+
+	b = new(bytes.Buffer)
+	err = engine.Render(b, "foo", map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, "<p>Hello</p><p>debug mode</p>", b.String())
+}
+
+func TestEngine_RenderSized(t *testing.T) {
 	engine := NewEngine(NoEscape)
 
 	err := engine.Register("layout", `<h1>HELLO {{ ChildContent }}!</h1>`)
@@ -122,130 +1371,407 @@ func TestEngine_Render_Layout(t *testing.T) {
 	require.NoError(t, err)
 
 	b := new(bytes.Buffer)
-	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	err = engine.RenderSized(b, "hello", map[string]any{"name": "Fox Mulder"}, 1024)
 	require.NoError(t, err)
 
 	require.Equal(t, "<h1>HELLO Fox Mulder!</h1>", b.String())
 }
 
-func TestEngine_Render_Nested_Layout(t *testing.T) {
+func TestEngine_MustRegister(t *testing.T) {
 	engine := NewEngine(NoEscape)
+	engine.MustRegister("hello", `{{ name }}`)
 
-	err := engine.Register("root", "<html>{{ ChildContent }}</html>")
+	b := new(bytes.Buffer)
+	err := engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
 	require.NoError(t, err)
-	err = engine.Register("layout", `{{ layout("root") }}<h1>HELLO {{ ChildContent }}!</h1>`)
+
+	require.Equal(t, "Fox Mulder", b.String())
+
+	require.PanicsWithValue(t, "bat: could not register template broken: could not create template: unexpected `end` without a matching block: on line 1", func() {
+		engine.MustRegister("broken", `{{ end }}`)
+	})
+}
+
+func TestEngine_RenderToString(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	err := engine.Register("layout", `<h1>HELLO {{ ChildContent }}!</h1>`)
 	require.NoError(t, err)
-	err = engine.Register("hello", `{{ layout("layout") }}{{ name }}`)
+	err = engine.Register("hello", `{{ layout("layout") }}{{ greet(name) }}`)
 	require.NoError(t, err)
 
-	b := new(bytes.Buffer)
-	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	out, err := engine.RenderWithHelpersToString("hello", map[string]any{"greet": func(s string) string { return "Agent " + s }}, map[string]any{"name": "Mulder"})
 	require.NoError(t, err)
+	require.Equal(t, "<h1>HELLO Agent Mulder!</h1>", out)
 
-	require.Equal(t, "<html><h1>HELLO Fox Mulder!</h1></html>", b.String())
+	_, err = engine.RenderToString("hello", map[string]any{"name": "Mulder"})
+	require.ErrorContains(t, err, "function 'greet' not defined")
+
+	_, err = engine.RenderToString("missing", nil)
+	require.ErrorContains(t, err, "template missing not found")
 }
 
-func TestEngine_Render_Layout_MultipleCalls(t *testing.T) {
+func TestEngine_RenderContext(t *testing.T) {
 	engine := NewEngine(NoEscape)
 
-	err := engine.Register("layout", `<h1>HELLO {{ ChildContent }}!</h1>`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	engine.Helper("stop", func() string {
+		cancel()
+		return ""
+	})
+
+	err := engine.Register("row", `<li>{{ stop() }}{{ name }}</li>`)
 	require.NoError(t, err)
-	err = engine.Register("hello", `{{ layout("layout") }}{{ layout("layout") }}`)
+	err = engine.Register("list", `<ul>{{range $_, $name in names}}{{ partial("row", {name: $name}) }}{{end}}</ul>`)
 	require.NoError(t, err)
 
 	b := new(bytes.Buffer)
-	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
-	require.ErrorContains(t, err, "layout already set")
+	err = engine.RenderContext(ctx, b, "list", map[string]any{"names": []string{"Fox", "Dana"}})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, "", b.String())
+
+	b = new(bytes.Buffer)
+	err = engine.RenderContext(context.Background(), b, "list", map[string]any{"names": []string{"Fox", "Dana"}})
+	require.NoError(t, err)
+	require.Equal(t, "<ul><li>Fox</li><li>Dana</li></ul>", b.String())
 }
 
-func TestEngine_Render_Layout_Missing(t *testing.T) {
+func TestEngine_Deregister(t *testing.T) {
 	engine := NewEngine(NoEscape)
-	err := engine.Register("hello", `{{ layout("layout") }}`)
+
+	err := engine.Register("hello", `{{ name }}`)
 	require.NoError(t, err)
 
+	require.True(t, engine.Deregister("hello"))
+	require.False(t, engine.Deregister("hello"))
+
 	b := new(bytes.Buffer)
 	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
-	require.Error(t, err)
+	require.EqualError(t, err, "template hello not found")
 }
 
-func TestEngine_Render_Layout_InheritsData(t *testing.T) {
+func TestEngine_Register_Overwrite(t *testing.T) {
 	engine := NewEngine(NoEscape)
-	err := engine.Register("layout", `<{{ Tag }}>HELLO {{ ChildContent }}!</{{ Tag }}>`)
-	require.NoError(t, err)
-	err = engine.Register("hello", `{{ layout("layout") }}{{ name }}`)
-	require.NoError(t, err)
+	engine.MustRegister("hello", `Hello {{ name }}`)
+	engine.MustRegister("hello", `Goodbye {{ name }}`)
 
-	b := new(bytes.Buffer)
-	err = engine.Render(b, "hello", map[string]any{"name": "Fox Mulder", "Tag": "h2"})
+	out, err := engine.RenderToString("hello", map[string]any{"name": "Fox"})
 	require.NoError(t, err)
-	require.Equal(t, "<h2>HELLO Fox Mulder!</h2>", b.String())
+	require.Equal(t, "Goodbye Fox", out)
 }
 
-func TestEngine_Render_Nested_LocalHelper(t *testing.T) {
+func TestEngine_Reload(t *testing.T) {
 	engine := NewEngine(NoEscape)
+	engine.MustRegister("hello", `Hello {{ name }}`)
+	engine.MustRegister("goodbye", `Goodbye {{ name }}`)
 
-	err := engine.Register("root", "<html>{{ ChildContent }}</html>")
+	require.NoError(t, engine.Reload("hello", `Hi {{ name }}`))
+
+	out, err := engine.RenderToString("hello", map[string]any{"name": "Fox"})
 	require.NoError(t, err)
-	err = engine.Register("layout", `{{ layout("root") }}<h1>HELLO {{ ChildContent }}!</h1>`)
+	require.Equal(t, "Hi Fox", out)
+
+	out, err = engine.RenderToString("goodbye", map[string]any{"name": "Fox"})
 	require.NoError(t, err)
-	err = engine.Register("hello", `{{ layout("layout") }}{{ omg() }}`)
+	require.Equal(t, "Goodbye Fox", out)
+
+	// Invalid templates keep the previous version
+	err = engine.Reload("hello", `Hi {{ name `)
+	require.Error(t, err)
+
+	out, err = engine.RenderToString("hello", map[string]any{"name": "Fox"})
 	require.NoError(t, err)
+	require.Equal(t, "Hi Fox", out)
+
+	err = engine.Reload("missing", `{{ name }}`)
+	require.EqualError(t, err, "template missing not found")
+	require.False(t, engine.Exists("missing"))
+}
+
+func TestEngine_Clear(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	engine.MustRegister("hello", `{{ name }}`)
+	engine.MustRegister("goodbye", `{{ name }}`)
+	engine.Clear()
 
-	helpers := map[string]any{
-		"omg": func() string { return "omg" },
-	}
 	b := new(bytes.Buffer)
-	err = engine.RenderWithHelpers(b, "hello", helpers, map[string]any{"name": "Fox Mulder"})
-	require.NoError(t, err)
+	err := engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+	require.EqualError(t, err, "template hello not found")
+	err = engine.Render(b, "goodbye", map[string]any{"name": "Fox Mulder"})
+	require.EqualError(t, err, "template goodbye not found")
+}
 
-	require.Equal(t, "<html><h1>HELLO omg!</h1></html>", b.String())
+func TestEngine_ConcurrentRegistration(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("hello", `{{ partial("name", {name: name}) }}`)
+	engine.MustRegister("name", `{{ name }}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("template-%d", i)
+			engine.MustRegister(name, `{{ name }}`)
+			engine.Deregister(name)
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			b := new(bytes.Buffer)
+			err := engine.Render(b, "hello", map[string]any{"name": "Fox Mulder"})
+			require.NoError(t, err)
+			require.Equal(t, "Fox Mulder", b.String())
+		}()
+	}
+
+	wg.Wait()
 }
 
-func TestEngine_DefaultHelper_Partial_Helpers(t *testing.T) {
+func TestEngine_ConcurrentHelpers(t *testing.T) {
 	engine := NewEngine(NoEscape)
+	engine.Helper("greet", func(name string) string { return "Hello " + name })
+	engine.MustRegister("hello", `{{ greet(name) }}`)
 
-	err := engine.Register("hello", "{{name}}. {{ omg() }}")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+
+			engine.Helper(fmt.Sprintf("helper%d", i), func() string { return "" })
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			out, err := engine.RenderToString("hello", map[string]any{"name": "Fox Mulder"})
+			require.NoError(t, err)
+			require.Equal(t, "Hello Fox Mulder", out)
+		}()
+	}
+
+	wg.Wait()
+
+	// Helpers added after a template is registered are available to it
+	engine.Helper("greet", func(name string) string { return "Bye " + name })
+
+	out, err := engine.RenderToString("hello", map[string]any{"name": "Fox Mulder"})
 	require.NoError(t, err)
-	err = engine.Register("foo", `Hi {{partial("hello", {name: name})}}`)
+	require.Equal(t, "Bye Fox Mulder", out)
+}
+
+func TestEngine_ExistsAndList(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	require.Equal(t, []string{}, engine.List())
+
+	engine.MustRegister("users/show", `{{ name }}`)
+	engine.MustRegister("layouts/application", `{{ ChildContent }}`)
+
+	require.True(t, engine.Exists("users/show"))
+	require.False(t, engine.Exists("users/edit"))
+
+	names := engine.List()
+	require.Equal(t, []string{"layouts/application", "users/show"}, names)
+
+	names[0] = "changed"
+	require.Equal(t, []string{"layouts/application", "users/show"}, engine.List())
+
+	engine.Deregister("users/show")
+	require.False(t, engine.Exists("users/show"))
+	require.Equal(t, []string{"layouts/application"}, engine.List())
+}
+
+func TestEngine_ListAutoRegistered(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	require.Equal(t, []string{}, engine.List())
+
+	err := engine.AutoRegister(fixtures, "", ".html")
 	require.NoError(t, err)
 
-	helpers := map[string]any{
-		"omg": func() string { return "omg" },
-	}
+	require.Equal(t, []string{"fixtures/home.html", "fixtures/users/hello.html"}, engine.List())
+	require.True(t, engine.Exists("fixtures/home.html"))
+	require.False(t, engine.Exists("fixtures/users.html"))
+}
+
+func TestEngine_DefaultHelper_Partial_ErrorLines(t *testing.T) {
+	engine := NewEngine(NoEscape)
+	engine.MustRegister("cell", "<td>\n{{ value.Name }}</td>")
+	engine.MustRegister("row", "<tr>\n\n{{ partial(\"cell\", {value: nil}) }}</tr>")
+	engine.MustRegister("page", "<table>\n\n\n{{ partial(\"row\", {}) }}</table>")
 
 	b := new(bytes.Buffer)
-	err = engine.RenderWithHelpers(b, "foo", helpers, map[string]any{"name": "Fox Mulder"})
+	err := engine.Render(b, "page", nil)
+	require.Error(t, err)
+
+	require.ErrorContains(t, err, "in partial 'cell' line 2, included from 'row' line 3")
+	require.ErrorContains(t, err, "in partial 'row' line 3, included from 'page' line 4")
+
+	var partialErr *PartialError
+	require.ErrorAs(t, err, &partialErr)
+	require.Equal(t, "row", partialErr.Partial)
+	require.Equal(t, 3, partialErr.Line)
+	require.Equal(t, "page", partialErr.IncludedFrom)
+	require.Equal(t, 4, partialErr.IncludedFromLine)
+
+	var execErr *ExecutionError
+	require.ErrorAs(t, err, &execErr)
+	require.Equal(t, "cell", execErr.Template)
+	require.Equal(t, 2, execErr.Line)
+}
+
+func TestEngine_Clone(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.Helper("greet", func(name string) string { return "Hello " + name })
+	engine.SetEnv(map[string]any{"stage": "test"})
+	engine.MustRegister("hello", `{{ greet(name) }} ({{ env("stage") }})`)
+
+	clone := engine.Clone()
+	clone.Helper("greet", func(name string) string { return "Goodbye " + name })
+	clone.MustRegister("extra", `<b>{{ name }}</b>`)
+	clone.SetEnv(map[string]any{"stage": "clone"})
+
+	out, err := engine.RenderToString("hello", map[string]any{"name": "Fox"})
 	require.NoError(t, err)
+	require.Equal(t, "Hello Fox (test)", out)
 
-	require.Equal(t, "Hi Fox Mulder. omg", b.String())
+	out, err = clone.RenderToString("hello", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "Goodbye Fox (clone)", out)
+
+	require.True(t, clone.Exists("extra"))
+	require.False(t, engine.Exists("extra"))
+
+	engine.Deregister("hello")
+	require.True(t, clone.Exists("hello"))
 }
 
-func TestEngine_Comments(t *testing.T) {
+func TestEngine_Match(t *testing.T) {
 	engine := NewEngine(NoEscape)
+	engine.MustRegister("pages/about", `about`)
+	engine.MustRegister("pages/home", `home`)
+	engine.MustRegister("pages/docs/intro", `intro`)
+	engine.MustRegister("layouts/application", `{{ ChildContent }}`)
 
-	err := engine.Register("hello", "Hello {{ // name }}")
+	matches, err := engine.Match("pages/*")
 	require.NoError(t, err)
+	require.Equal(t, []string{"pages/about", "pages/home"}, matches)
 
-	helpers := map[string]any{}
+	matches, err = engine.Match("*/application")
+	require.NoError(t, err)
+	require.Equal(t, []string{"layouts/application"}, matches)
 
-	b := new(bytes.Buffer)
-	err = engine.RenderWithHelpers(b, "hello", helpers, map[string]any{"name": "Fox Mulder"})
+	matches, err = engine.Match("partials/*")
+	require.NoError(t, err)
+	require.Equal(t, []string{}, matches)
+}
+
+func TestEngine_Match_InvalidPattern(t *testing.T) {
+	engine := NewEngine(NoEscape)
+
+	_, err := engine.Match("pages/[")
+	require.ErrorIs(t, err, path.ErrBadPattern)
+
+	engine.MustRegister("pages/about", `about`)
+	_, err = engine.Match("pages/[")
+	require.ErrorIs(t, err, path.ErrBadPattern)
+}
+
+func TestEngine_Delimiters(t *testing.T) {
+	engine := NewEngine(NoEscape, WithEngineDelimiters("[[", "]]"))
+	engine.MustRegister("greeting", `Hello [[ names[0] ]]`)
+	engine.MustRegister("page", `{{ title }}: [[ partial("greeting", {names: names}) ]]`)
+
+	out, err := engine.RenderToString("page", map[string]any{"names": []string{"Fox"}})
 	require.NoError(t, err)
+	require.Equal(t, "{{ title }}: Hello Fox", out)
 
-	require.Equal(t, "Hello ", b.String())
+	engine = NewEngine(NoEscape, WithEngineDelimiters("[", "]"))
+	err = engine.Register("invalid", `hi`)
+	require.EqualError(t, err, `could not create template: delimiters "[" and "]" must be at least two characters`)
 }
 
-func TestEngine_CommentAfterStatement(t *testing.T) {
+func TestEngine_SetDelimiters(t *testing.T) {
 	engine := NewEngine(NoEscape)
+	engine.MustRegister("before", `{{ name }} <% name %>`)
 
-	err := engine.Register("hello", "Hello {{ name // Necessary }}")
+	require.NoError(t, engine.SetDelimiters("<%", "%>"))
+	engine.MustRegister("after", `{{ name }} <% name %>`)
+
+	out, err := engine.RenderToString("before", map[string]any{"name": "Fox"})
 	require.NoError(t, err)
+	require.Equal(t, "Fox <% name %>", out)
 
-	helpers := map[string]any{}
+	out, err = engine.RenderToString("after", map[string]any{"name": "Fox"})
+	require.NoError(t, err)
+	require.Equal(t, "{{ name }} Fox", out)
 
-	b := new(bytes.Buffer)
-	err = engine.RenderWithHelpers(b, "hello", helpers, map[string]any{"name": "Fox Mulder"})
+	err = engine.SetDelimiters("", "}}")
+	require.EqualError(t, err, `delimiters "" and "}}" must be at least two characters`)
+
+	err = engine.SetDelimiters("{{", "{{")
+	require.EqualError(t, err, `delimiters "{{" and "{{" can't contain each other`)
+
+	// Invalid delimiters leave the current delimiters in place
+	engine.MustRegister("unchanged", `<% name %>`)
+	out, err = engine.RenderToString("unchanged", map[string]any{"name": "Fox"})
 	require.NoError(t, err)
+	require.Equal(t, "Fox", out)
+}
 
-	require.Equal(t, "Hello Fox Mulder", b.String())
+func TestEngine_CollapseWhitespace(t *testing.T) {
+	engine := NewEngine(NoEscape, WithCollapseWhitespace())
+	engine.MustRegister("page", `<ul>
+  {{ range $i, $name in names }}
+    <li>{{ $name }}</li>
+  {{ end }}
+</ul>
+<pre>
+  {{ code }}
+</pre>`)
+
+	// Each text node is collapsed separately, so text on either side of an
+	// action can still render adjacent spaces.
+	out, err := engine.RenderToString("page", map[string]any{"names": []string{"Fox  Mulder"}, "code": "x  := 1"})
+	require.NoError(t, err)
+	require.Equal(t, "<ul>  <li>Fox  Mulder</li>  </ul> <pre>\n  x  := 1\n</pre>", out)
+
+	engine = NewEngine(NoEscape)
+	engine.MustRegister("page", "<p>\n  hi\n</p>")
+
+	out, err = engine.RenderToString("page", nil)
+	require.NoError(t, err)
+	require.Equal(t, "<p>\n  hi\n</p>", out)
+}
+
+func TestEngine_JSONTagAccess(t *testing.T) {
+	type account struct {
+		Email    string `json:"email"`
+		Name     string `json:"name,omitempty"`
+		Password string `json:"-"`
+		Plan     string
+	}
+
+	engine := NewEngine(NoEscape, WithJSONTagAccess())
+	engine.MustRegister("account", `{{ user["email"] }} {{ user["name"] }} {{ user["Plan"] }} {{ user.Email }}`)
+
+	out, err := engine.RenderToString("account", map[string]any{"user": &account{Email: "fox@fbi.gov", Name: "Fox", Plan: "pro"}})
+	require.NoError(t, err)
+	require.Equal(t, "fox@fbi.gov Fox pro fox@fbi.gov", out)
+
+	engine.MustRegister("password", `{{ user["Password"] }}`)
+	_, err = engine.RenderToString("password", map[string]any{"user": account{}})
+	require.ErrorContains(t, err, "no field with json name 'Password' for type bat.account")
+
+	engine = NewEngine(NoEscape)
+	engine.MustRegister("account", `{{ user["email"] }}`)
+	_, err = engine.RenderToString("account", map[string]any{"user": account{}})
+	require.ErrorContains(t, err, "cannot index non-map/non-slice")
 }
@@ -0,0 +1,377 @@
+package bat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/blakewilliams/bat/internal/mapsort"
+)
+
+// Entry is a key/value pair of a map, returned by the entries helper.
+type Entry struct {
+	Key   any
+	Value any
+}
+
+// defaultHelpers returns the helpers available to every template registered
+// with the given engine.
+func defaultHelpers(engine *Engine) map[string]any {
+	return map[string]any{
+		"len": func(v any) int {
+			return reflect.ValueOf(v).Len()
+		},
+		"safe": func(s string) Safe {
+			return Safe(s)
+		},
+		"upper": stringHelper("upper", strings.ToUpper),
+		"lower": stringHelper("lower", strings.ToLower),
+		"title": stringHelper("title", strings.ToTitle),
+		"trim":  stringHelper("trim", strings.TrimSpace),
+		"trimLeft": func(s any, cutset string) any {
+			return stringHelper("trimLeft", func(s string) string { return strings.TrimLeft(s, cutset) })(s)
+		},
+		"trimRight": func(s any, cutset string) any {
+			return stringHelper("trimRight", func(s string) string { return strings.TrimRight(s, cutset) })(s)
+		},
+		"replace": func(s any, old string, new string) any {
+			return stringHelper("replace", func(s string) string { return strings.ReplaceAll(s, old, new) })(s)
+		},
+		"split": func(s string, sep string) []string {
+			return strings.Split(s, sep)
+		},
+		"join": templateHelper(func(t *Template) any {
+			return func(parts any, sep string) any {
+				v := reflect.ValueOf(parts)
+				if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+					panic(fmt.Sprintf("join expects a slice, got %T", parts))
+				}
+
+				// When any part is Safe, the other parts are escaped so the
+				// result can be Safe without escaping the Safe parts twice.
+				hasSafe := false
+				for i := 0; i < v.Len(); i++ {
+					if _, ok := v.Index(i).Interface().(Safe); ok {
+						hasSafe = true
+						break
+					}
+				}
+
+				escapeFunc := NoEscape
+				if hasSafe {
+					escapeFunc = t.escapeFunc
+				}
+
+				strs := make([]string, v.Len())
+				for i := range strs {
+					strs[i] = valueToString(v.Index(i).Interface(), escapeFunc)
+				}
+
+				if !hasSafe {
+					return strings.Join(strs, sep)
+				}
+
+				return Safe(strings.Join(strs, escapeFunc(sep)))
+			}
+		}),
+		"first": templateHelper(func(t *Template) any {
+			return func(slice any) any {
+				return sliceIndex("first", slice, 0, t.strict)
+			}
+		}),
+		"last": templateHelper(func(t *Template) any {
+			return func(slice any) any {
+				return sliceIndex("last", slice, -1, t.strict)
+			}
+		}),
+		"nth": templateHelper(func(t *Template) any {
+			return func(slice any, n int) any {
+				if n < 0 {
+					if t.strict {
+						panic(fmt.Sprintf("nth index must not be negative, got %d", n))
+					}
+
+					return nil
+				}
+
+				return sliceIndex("nth", slice, n, t.strict)
+			}
+		}),
+		"chunk": func(slice any, size int) [][]any {
+			if size <= 0 {
+				panic(fmt.Sprintf("chunk size must be greater than 0, got %d", size))
+			}
+
+			v := reflect.ValueOf(slice)
+			if !v.IsValid() {
+				return [][]any{}
+			}
+
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				panic(fmt.Sprintf("chunk expects a slice, got %T", slice))
+			}
+
+			chunks := make([][]any, 0, (v.Len()+size-1)/size)
+			for i := 0; i < v.Len(); i += size {
+				chunk := make([]any, 0, size)
+				for j := i; j < i+size && j < v.Len(); j++ {
+					chunk = append(chunk, v.Index(j).Interface())
+				}
+
+				chunks = append(chunks, chunk)
+			}
+
+			return chunks
+		},
+		"contains": func(collection any, item any) bool {
+			ok, err := contains(collection, item)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			return ok
+		},
+		"bitor": func(a any, b any) any {
+			result, err := bitwise("|", a, b)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			return result
+		},
+		"int": func(v any) int {
+			rv := reflect.ValueOf(v)
+			switch genericType(rv) {
+			case coreInt, coreUint, coreFloat:
+				return int(rv.Convert(reflect.TypeOf(0)).Int())
+			default:
+				panic(fmt.Sprintf("int can't convert %T to an int", v))
+			}
+		},
+		"float": func(v any) float64 {
+			rv := reflect.ValueOf(v)
+			switch genericType(rv) {
+			case coreInt, coreUint, coreFloat:
+				return rv.Convert(reflect.TypeOf(0.0)).Float()
+			default:
+				panic(fmt.Sprintf("float can't convert %T to a float", v))
+			}
+		},
+		"toBool": func(s string) bool {
+			switch strings.ToLower(strings.TrimSpace(s)) {
+			case "true", "1", "yes":
+				return true
+			case "false", "0", "no":
+				return false
+			default:
+				panic(fmt.Sprintf("toBool can't convert %q to a bool", s))
+			}
+		},
+		"default": func(v any, fallback any) any {
+			if rv := reflect.ValueOf(v); !rv.IsValid() || rv.IsZero() {
+				return fallback
+			}
+
+			return v
+		},
+		"defaultNil": func(v any, fallback any) any {
+			if isNil(reflect.ValueOf(v)) {
+				return fallback
+			}
+
+			return v
+		},
+		"urlEncode": func(s string) Safe {
+			return Safe(url.QueryEscape(s))
+		},
+		"urlPathEscape": func(s string) Safe {
+			return Safe(url.PathEscape(s))
+		},
+		"toJSON": func(v any) Safe {
+			b, err := json.Marshal(v)
+			if err != nil {
+				panic(fmt.Sprintf("could not convert %T to JSON: %s", v, err))
+			}
+
+			return Safe(b)
+		},
+		"toJSONPretty": func(v any) Safe {
+			b, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				panic(fmt.Sprintf("could not convert %T to JSON: %s", v, err))
+			}
+
+			return Safe(b)
+		},
+		"env": func(key string) any {
+			engine.mu.RLock()
+			defer engine.mu.RUnlock()
+
+			return engine.env[key]
+		},
+		"wrap": templateHelper(func(t *Template) any {
+			return func(v any, before string, after string) Safe {
+				output := valueToString(v, t.escapeFunc)
+				if output == "" {
+					return ""
+				}
+
+				return Safe(before + output + after)
+			}
+		}),
+		"sanitize": func(s string) Safe {
+			if engine.sanitizer == nil {
+				panic("sanitize called without a sanitizer, provide one using WithSanitizer")
+			}
+
+			return Safe(engine.sanitizer(s))
+		},
+		"fieldTag": func(v any, field string, key string) string {
+			t := reflect.TypeOf(v)
+			if t != nil && t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+
+			if t == nil || t.Kind() != reflect.Struct {
+				panic(fmt.Sprintf("fieldTag expects a struct, got %T", v))
+			}
+
+			f, ok := t.FieldByName(field)
+			if !ok {
+				panic(fmt.Sprintf("no field '%s' for type %s", field, t))
+			}
+
+			return f.Tag.Get(key)
+		},
+		"entries": func(m any) []Entry {
+			v := reflect.ValueOf(m)
+			if v.Kind() != reflect.Map {
+				panic(fmt.Sprintf("entries expects a map, got %T", m))
+			}
+
+			sorted := mapsort.Sort(v)
+			entries := make([]Entry, len(sorted.Keys))
+			for i := range sorted.Keys {
+				entries[i] = Entry{Key: sorted.Keys[i].Interface(), Value: sorted.Values[i].Interface()}
+			}
+
+			return entries
+		},
+		"keys": func(v any) []any {
+			keys, _ := keysAndValues("keys", v)
+			return keys
+		},
+		"values": func(v any) []any {
+			_, values := keysAndValues("values", v)
+			return values
+		},
+		"currency": func(amount any, code string) string {
+			return formatCurrency(amount, code)
+		},
+		"debug": templateHelper(func(t *Template) any {
+			return func(v any) Safe {
+				if engine.debugDisabled {
+					log.Println("bat: debug helper called while disabled, rendering nothing")
+					return ""
+				}
+
+				output := t.escapeFunc(dump(v))
+				if isHTMLEscape(t.escapeFunc) {
+					return Safe("<pre>" + output + "</pre>")
+				}
+
+				return Safe(output)
+			}
+		}),
+	}
+}
+
+// sliceIndex returns the element of a slice or array at index i, or nil if
+// it's out of bounds. In strict mode, out of bounds indexes panic instead. A
+// negative index counts back from the end.
+func sliceIndex(name string, slice any, i int, strict bool) any {
+	v := reflect.ValueOf(slice)
+	if !v.IsValid() {
+		if strict {
+			panic(fmt.Sprintf("%s expects a slice, got nil", name))
+		}
+
+		return nil
+	}
+
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		panic(fmt.Sprintf("%s expects a slice, got %T", name, slice))
+	}
+
+	index := i
+	if i < 0 {
+		i += v.Len()
+	}
+
+	if i < 0 || i >= v.Len() {
+		if strict {
+			panic(fmt.Sprintf("%s index %d out of range for length %d", name, index, v.Len()))
+		}
+
+		return nil
+	}
+
+	return v.Index(i).Interface()
+}
+
+// keysAndValues returns the keys and values of a map sorted by key, or the
+// names and values of a struct's exported fields in the order they're
+// declared.
+func keysAndValues(name string, v any) ([]any, []any) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		sorted := mapsort.Sort(rv)
+		keys := make([]any, len(sorted.Keys))
+		values := make([]any, len(sorted.Values))
+		for i := range sorted.Keys {
+			keys[i] = sorted.Keys[i].Interface()
+			values[i] = sorted.Values[i].Interface()
+		}
+
+		return keys, values
+	case reflect.Struct:
+		t := rv.Type()
+		keys := make([]any, 0, t.NumField())
+		values := make([]any, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+
+			keys = append(keys, t.Field(i).Name)
+			values = append(values, rv.Field(i).Interface())
+		}
+
+		return keys, values
+	default:
+		panic(fmt.Sprintf("%s expects a map or struct, got %T", name, v))
+	}
+}
+
+// stringHelper returns a helper that applies fn to strings. Safe values stay
+// Safe, so helpers like upper don't cause safe HTML to be escaped.
+func stringHelper(name string, fn func(string) string) func(s any) any {
+	return func(s any) any {
+		switch s := s.(type) {
+		case Safe:
+			return Safe(fn(string(s)))
+		case string:
+			return fn(s)
+		default:
+			panic(fmt.Sprintf("%s expects a string, got %T", name, s))
+		}
+	}
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -15,6 +16,20 @@ type (
 		Tokens    []Token
 		Line      int
 		StartLine int
+		// openers tracks open curlies, brackets, and parens so that a closing
+		// character matching the right delimiter, like `}}` closing nested
+		// maps, isn't mistaken for the right delimiter.
+		openers    []opener
+		leftDelim  string
+		rightDelim string
+		// actionLine is the line the current action was opened on.
+		actionLine int
+	}
+
+	// opener is an open curly, bracket, or paren and the line it's on.
+	opener struct {
+		char rune
+		line int
 	}
 
 	Kind int
@@ -25,18 +40,39 @@ type (
 const eof = -1
 
 const (
-	leftDelim  = "{{"
-	rightDelim = "}}"
+	DefaultLeftDelim  = "{{"
+	DefaultRightDelim = "}}"
 )
 
+// Lex tokenizes input using the default `{{` and `}}` delimiters.
 func Lex(input string) *Lexer {
-	l := &Lexer{Input: input, Tokens: make([]Token, 0), StartLine: 1, Line: 1}
+	return LexWithDelimiters(input, DefaultLeftDelim, DefaultRightDelim)
+}
+
+// LexWithDelimiters tokenizes input using the given delimiters to mark the
+// start and end of actions.
+func LexWithDelimiters(input string, left string, right string) *Lexer {
+	l := &Lexer{
+		Input:      input,
+		Tokens:     make([]Token, 0),
+		StartLine:  1,
+		Line:       1,
+		leftDelim:  left,
+		rightDelim: right,
+	}
 	l.run()
 
 	return l
 }
 
 func (l *Lexer) run() {
+	if l.leftDelim == "" {
+		l.leftDelim = DefaultLeftDelim
+	}
+	if l.rightDelim == "" {
+		l.rightDelim = DefaultRightDelim
+	}
+
 	for state := lexText; state != nil; {
 		state = state(l)
 	}
@@ -91,13 +127,16 @@ func (l *Lexer) backup() {
 
 func (l *Lexer) peek() rune {
 	r := l.next()
+	if r == eof {
+		return eof
+	}
 	l.backup()
 
 	return r
 }
 
 func lexText(l *Lexer) stateFn {
-	if index := strings.Index(l.Input[l.start:], leftDelim); index >= 0 {
+	if index := strings.Index(l.Input[l.start:], l.leftDelim); index >= 0 {
 		if index > 0 {
 			l.pos = l.start + index
 
@@ -120,25 +159,77 @@ func lexText(l *Lexer) stateFn {
 }
 
 func lexLeftDelim(l *Lexer) stateFn {
-	l.pos += len(leftDelim)
+	l.actionLine = l.Line
+	l.pos += len(l.leftDelim)
 	l.emit(KindLeftDelim)
 
 	return lexAction
 }
 
 func lexAction(l *Lexer) stateFn {
+	if len(l.openers) == 0 && strings.HasPrefix(l.Input[l.pos:], l.rightDelim) {
+		return lexRightDelim
+	}
+
+	if l.pos >= len(l.Input) {
+		l.emitUnclosedError()
+		return nil
+	}
+
 	r := l.peek()
 	switch {
 	case r == '}':
-		return lexRightDelim
+		l.next()
+		l.closeDepth()
+		l.emit(KindCloseCurly)
+		return lexAction
 	case r == '{':
 		l.next()
+		l.open(r)
 		l.emit(KindOpenCurly)
 		return lexAction
 	case r == '.':
 		l.next()
+		if l.peek() == '.' {
+			l.next()
+			l.emit(KindDotDot)
+			return lexAction
+		}
+
 		l.emit(KindDot)
 		return lexAction
+	case r == '?' && strings.HasPrefix(l.Input[l.pos:], "?."):
+		l.pos += len("?.")
+		l.emit(KindOptionalDot)
+		return lexAction
+	case r == '?' && strings.HasPrefix(l.Input[l.pos:], "??"):
+		l.pos += len("??")
+		l.emit(KindNullCoalesce)
+		return lexAction
+	case r == '?':
+		l.next()
+		l.emit(KindQuestion)
+		return lexAction
+	case r == '&' && strings.HasPrefix(l.Input[l.pos:], "&&"):
+		l.pos += len("&&")
+		l.emit(KindAnd)
+		return lexAction
+	case r == '|' && strings.HasPrefix(l.Input[l.pos:], "||"):
+		l.pos += len("||")
+		l.emit(KindOr)
+		return lexAction
+	case r == '&':
+		l.next()
+		l.emit(KindAmpersand)
+		return lexAction
+	case r == '^':
+		l.next()
+		l.emit(KindCaret)
+		return lexAction
+	case r == '|':
+		l.next()
+		l.emit(KindPipe)
+		return lexAction
 	case r == '#':
 		l.next()
 		l.emit(KindHash)
@@ -171,24 +262,32 @@ func lexAction(l *Lexer) stateFn {
 		l.next()
 		l.emit(KindPercent)
 		return lexAction
+	case r == ';':
+		l.next()
+		l.emit(KindSemicolon)
+		return lexAction
 	case r == ',':
 		l.next()
 		l.emit(KindComma)
 		return lexAction
 	case r == '(':
 		l.next()
+		l.open(r)
 		l.emit(KindOpenParen)
 		return lexAction
 	case r == ')':
 		l.next()
+		l.closeDepth()
 		l.emit(KindCloseParen)
 		return lexAction
 	case r == '[':
 		l.next()
+		l.open(r)
 		l.emit(KindOpenBracket)
 		return lexAction
 	case r == ']':
 		l.next()
+		l.closeDepth()
 		l.emit(KindCloseBracket)
 		return lexAction
 	case r == '<':
@@ -226,18 +325,40 @@ func lexAction(l *Lexer) stateFn {
 }
 
 func lexRightDelim(l *Lexer) stateFn {
-	if !strings.HasPrefix(l.Input[l.pos:], rightDelim) {
-		l.next()
-		l.emit(KindCloseCurly)
-		return lexAction
-	}
-
-	l.pos += len(rightDelim)
+	l.pos += len(l.rightDelim)
 	l.emit(KindRightDelim)
 
 	return lexText
 }
 
+// open tracks an open curly, bracket, or paren.
+func (l *Lexer) open(r rune) {
+	l.openers = append(l.openers, opener{char: r, line: l.Line})
+}
+
+// closeDepth closes the last open curly, bracket, or paren, ignoring
+// unbalanced closing characters so that the parser can report them.
+func (l *Lexer) closeDepth() {
+	if len(l.openers) > 0 {
+		l.openers = l.openers[:len(l.openers)-1]
+	}
+}
+
+// emitUnclosedError emits an error for input that ends inside of an action,
+// pointing at the innermost curly, bracket, or paren that wasn't closed, or
+// the left delimiter if they're all closed.
+func (l *Lexer) emitUnclosedError() {
+	lines := strings.Split(l.Input, "\n")
+
+	char, line := l.leftDelim, l.actionLine
+	if len(l.openers) > 0 {
+		last := l.openers[len(l.openers)-1]
+		char, line = string(last.char), last.line
+	}
+
+	l.emitError(fmt.Sprintf("unclosed %s opened on line %d:\n%s", char, line, lines[line-1]))
+}
+
 func lexVariable(l *Lexer) stateFn {
 	for {
 		r := l.next()
@@ -271,30 +392,292 @@ func lexIdentifier(l *Lexer) stateFn {
 		}
 	}
 
-	switch l.currentText() {
-	case "if":
-		l.emit(KindIf)
-	case "else":
-		l.emit(KindElse)
-	case "nil":
-		l.emit(KindNil)
-	case "end":
-		l.emit(KindEnd)
-	case "true":
-		l.emit(KindTrue)
-	case "false":
-		l.emit(KindFalse)
-	case "in":
-		l.emit(KindIn)
-	case "range":
-		l.emit(KindRange)
-	default:
-		l.emit(KindIdentifier)
+	if l.currentText() == "raw" && l.isRawStart() {
+		l.emit(KindRaw)
+		return lexRawStart
 	}
 
+	kind, ok := keywords[l.currentText()]
+	if !ok || !l.isKeyword(kind) {
+		kind = KindIdentifier
+	}
+	l.emit(kind)
+
 	return lexAction
 }
 
+// keywords maps reserved words to their kind. Some keywords are contextual,
+// see isKeyword.
+var keywords = map[string]Kind{
+	"if":         KindIf,
+	"else":       KindElse,
+	"nil":        KindNil,
+	"end":        KindEnd,
+	"true":       KindTrue,
+	"false":      KindFalse,
+	"in":         KindIn,
+	"range":      KindRange,
+	"break":      KindBreak,
+	"continue":   KindContinue,
+	"let":        KindLet,
+	"with":       KindWith,
+	"do":         KindDo,
+	"defined":    KindDefined,
+	"switch":     KindSwitch,
+	"case":       KindCase,
+	"slot":       KindSlot,
+	"contentFor": KindSlot,
+	"yield":      KindYield,
+	"capture":    KindCapture,
+	"block":      KindBlock,
+	"define":     KindDefine,
+}
+
+// isKeyword returns true when the lexed word is used as a keyword of the given
+// kind. Keywords added after templates could already use the word as a name
+// are only keywords where the name wouldn't make sense, e.g. `{{ block "x" }}`
+// is a block while `{{ block }}` accesses data named block.
+func (l *Lexer) isKeyword(kind Kind) bool {
+	switch kind {
+	case KindBlock, KindDefine:
+		return l.isStatementStart() && l.nextStartsWith(`"`, "(")
+	case KindSlot:
+		// `contentFor("head", value)` calls the contentFor helper instead of
+		// starting a slot block
+		return l.isStatementStart() && l.nextStartsWith(`"`, "(") && !isMultiArgumentCall(l.Input[l.pos:])
+	case KindYield:
+		return l.isStatementStart() && l.nextStartsWith(l.rightDelim, `"`, "(")
+	case KindWith, KindSwitch, KindCase, KindDo, KindCapture:
+		return l.isStatementStart() && l.followedByExpression()
+	case KindBreak, KindContinue:
+		return l.isStatementStart() && l.nextStartsWith(l.rightDelim)
+	case KindLet:
+		return l.isStatementStart() && l.followedByVariable()
+	case KindDefined:
+		// `defined in list` checks whether data named defined is in list
+		return l.followedByExpression() && !l.nextIsWord("in")
+	default:
+		return true
+	}
+}
+
+// isStatementStart returns true when the lexed word is the first thing in its
+// action, or follows a `;`.
+func (l *Lexer) isStatementStart() bool {
+	for i := len(l.Tokens) - 1; i >= 0; i-- {
+		switch l.Tokens[i].Kind {
+		case KindSpace:
+			continue
+		case KindLeftDelim, KindSemicolon:
+			return true
+		}
+
+		return false
+	}
+
+	return false
+}
+
+// nextStartsWith returns true when the input after the lexed word and any
+// whitespace starts with one of the given prefixes.
+func (l *Lexer) nextStartsWith(prefixes ...string) bool {
+	rest := strings.TrimLeftFunc(l.Input[l.pos:], unicode.IsSpace)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(rest, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// followedByExpression returns true when the lexed word is followed by
+// whitespace and the start of an expression, e.g. `switch kind`, rather than
+// an operator or the end of the action.
+func (l *Lexer) followedByExpression() bool {
+	rest := l.Input[l.pos:]
+	if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsSpace(r) {
+		return false
+	}
+
+	rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	if strings.HasPrefix(rest, l.rightDelim) {
+		return false
+	}
+
+	r, size := utf8.DecodeRuneInString(rest)
+	switch {
+	case unicode.IsLetter(r), unicode.IsDigit(r), strings.ContainsRune(`_$"([{!.`, r):
+		return true
+	case r == '-':
+		next, _ := utf8.DecodeRuneInString(rest[size:])
+		return unicode.IsDigit(next)
+	default:
+		return false
+	}
+}
+
+// followedByVariable returns true when the lexed word is followed by whitespace
+// and a variable, e.g. `let $total`.
+func (l *Lexer) followedByVariable() bool {
+	rest := l.Input[l.pos:]
+	if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsSpace(r) {
+		return false
+	}
+
+	return strings.HasPrefix(strings.TrimLeftFunc(rest, unicode.IsSpace), "$")
+}
+
+// nextIsWord returns true when the input after the lexed word and any
+// whitespace is the given word, e.g. `in`.
+func (l *Lexer) nextIsWord(word string) bool {
+	rest := strings.TrimLeftFunc(l.Input[l.pos:], unicode.IsSpace)
+	if !strings.HasPrefix(rest, word) {
+		return false
+	}
+
+	r, _ := utf8.DecodeRuneInString(rest[len(word):])
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// isRawStart returns true when the lexed `raw` is the only thing in its action,
+// e.g. `{{ raw }}`, so that data named raw can still be accessed.
+func (l *Lexer) isRawStart() bool {
+	return l.isStatementStart() && l.nextStartsWith(l.rightDelim)
+}
+
+// lexRawStart lexes the rest of a `{{ raw }}` action, then the content of the
+// raw block.
+func lexRawStart(l *Lexer) stateFn {
+	if unicode.IsSpace(l.peek()) {
+		for unicode.IsSpace(l.peek()) {
+			l.next()
+		}
+		l.emit(KindSpace)
+	}
+
+	l.pos += len(l.rightDelim)
+	l.emit(KindRightDelim)
+
+	return lexRawText
+}
+
+// lexRawText emits everything up to the `{{ end }}` that closes the raw block
+// as text, without lexing any delimiters inside of it. Blocks inside of the raw
+// block, like `{{ if }}...{{ end }}`, are tracked so their `{{ end }}` doesn't
+// close the raw block.
+func lexRawText(l *Lexer) stateFn {
+	depth := 0
+
+	for offset := l.pos; ; {
+		index := strings.Index(l.Input[offset:], l.leftDelim)
+		if index < 0 {
+			l.emitError(fmt.Sprintf("unclosed raw block starting on line %d", l.StartLine))
+			return nil
+		}
+
+		offset += index
+		action := strings.TrimLeftFunc(l.Input[offset+len(l.leftDelim):], unicode.IsSpace)
+
+		switch {
+		case l.isRawBlockStart(action):
+			depth++
+		case l.isRawWord(action, "end"):
+			if depth > 0 {
+				depth--
+				break
+			}
+
+			if offset > l.pos {
+				l.Line += strings.Count(l.Input[l.pos:offset], "\n")
+				l.pos = offset
+				l.emit(KindText)
+			}
+
+			return lexLeftDelim
+		}
+
+		offset += len(l.leftDelim)
+	}
+}
+
+// isRawBlockStart returns true when the action inside of a raw block starts a
+// block that is ended by `{{ end }}`, e.g. `if user }}` or `raw }}`. Keywords
+// that can also be names, like `block`, only start a block when they're
+// followed by something.
+func (l *Lexer) isRawBlockStart(action string) bool {
+	if l.isRawWord(action, "raw") {
+		return true
+	}
+
+	word := action
+	if end := strings.IndexFunc(action, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); end != -1 {
+		word = action[:end]
+	}
+
+	rest := action[len(word):]
+	if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsSpace(r) && r != '(' && r != '"' && !strings.HasPrefix(rest, l.rightDelim) {
+		return false
+	}
+
+	switch word {
+	case "if", "range":
+		return true
+	case "with", "switch", "capture", "block", "define":
+		return !strings.HasPrefix(strings.TrimLeftFunc(rest, unicode.IsSpace), l.rightDelim)
+	case "slot", "contentFor":
+		return !strings.HasPrefix(strings.TrimLeftFunc(rest, unicode.IsSpace), l.rightDelim) && !isMultiArgumentCall(rest)
+	default:
+		return false
+	}
+}
+
+// isMultiArgumentCall returns true when s starts with the arguments of a call
+// that has more than one argument, e.g. `("head", value)`.
+func isMultiArgumentCall(s string) bool {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	if !strings.HasPrefix(s, "(") {
+		return false
+	}
+
+	depth := 0
+	inString := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString && c == '\\':
+			i++
+		case inString:
+			inString = c != '"'
+		case c == '"':
+			inString = true
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			if depth == 0 {
+				return false
+			}
+		case c == ',' && depth == 1:
+			return true
+		}
+	}
+
+	return false
+}
+
+// isRawWord returns true when the action inside of a raw block only contains
+// word, e.g. `end }}`.
+func (l *Lexer) isRawWord(action string, word string) bool {
+	if !strings.HasPrefix(action, word) {
+		return false
+	}
+
+	rest := strings.TrimLeftFunc(action[len(word):], unicode.IsSpace)
+	return strings.HasPrefix(rest, l.rightDelim)
+}
+
 func lexString(l *Lexer) stateFn {
 	isEscape := false
 
@@ -302,7 +685,9 @@ func lexString(l *Lexer) stateFn {
 		r := l.next()
 
 		if r == eof {
-			panic("unexpected EOF")
+			lines := strings.Split(l.Input, "\n")
+			l.emitError(fmt.Sprintf("unclosed string opened on line %d:\n%s", l.StartLine, lines[l.StartLine-1]))
+			return nil
 		}
 
 		if r == '\\' {
@@ -341,6 +726,32 @@ func lexSpace(l *Lexer) stateFn {
 	return lexAction
 }
 
+// emitNumberError emits an error for the malformed number being lexed.
+func (l *Lexer) emitNumberError() {
+	lines := strings.Split(l.Input, "\n")
+
+	reason := ""
+	if isLeadingZeroNumber(l.currentText()) {
+		reason = ", leading zeros are not allowed, use the 0o prefix for octal"
+	} else if strings.Contains(l.currentText(), "_") {
+		reason = ", underscores must be between digits"
+	}
+
+	l.emitError(
+		fmt.Sprintf("invalid number %s%s on line %d:\n%s", l.currentText(), reason, l.Line, lines[l.Line-1]),
+	)
+}
+
+// isLeadingZeroNumber returns true for decimal numbers with a leading zero,
+// e.g. `010`, which Go would parse as octal.
+func isLeadingZeroNumber(s string) bool {
+	return len(s) > 1 && s[0] == '0' && (unicode.IsDigit(rune(s[1])) || s[1] == '_')
+}
+
+// lexNumber lexes integer literals, which can be decimal or prefixed with 0x,
+// 0o, or 0b for hex, octal, or binary and can contain underscores, e.g.
+// `1_000` or `0xFF`. Decimal numbers can't have a leading zero, since `010`
+// would otherwise silently be octal.
 func lexNumber(l *Lexer) stateFn {
 	for {
 		r := l.next()
@@ -349,12 +760,17 @@ func lexNumber(l *Lexer) stateFn {
 			break
 		}
 
-		if !unicode.IsNumber(r) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
 			l.backup()
 			break
 		}
 	}
 
+	if _, err := strconv.ParseInt(l.currentText(), 0, 64); err != nil || isLeadingZeroNumber(l.currentText()) {
+		l.emitNumberError()
+		return nil
+	}
+
 	l.emit(KindNumber)
 
 	return lexAction
@@ -419,7 +419,7 @@ func TestLex_UnderscoreVariable(t *testing.T) {
 }
 
 func TestLex_InvalidVariableName(t *testing.T) {
-	input := `{{ $^ }}`
+	input := `{{ $@ }}`
 	l := Lexer{Input: input, Tokens: make([]Token, 0), Line: 1}
 
 	l.run()
@@ -441,3 +441,394 @@ func TestLex_UnderscoreIdentifier(t *testing.T) {
 
 	require.Equal(t, "_", l.Tokens[2].Value)
 }
+
+func TestLex_DotDot(t *testing.T) {
+	input := "{{1..count}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 6)
+
+	require.Equal(t, l.Tokens[1].Kind, KindNumber)
+	require.Equal(t, l.Tokens[2].Kind, KindDotDot)
+	require.Equal(t, l.Tokens[2].Value, "..")
+	require.Equal(t, l.Tokens[3].Kind, KindIdentifier)
+}
+
+func TestLex_Break(t *testing.T) {
+	input := "{{break}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 4)
+
+	require.Equal(t, l.Tokens[1].Kind, KindBreak)
+	require.Equal(t, l.Tokens[1].Value, "break")
+}
+
+func TestLex_Continue(t *testing.T) {
+	input := "{{continue}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 4)
+
+	require.Equal(t, l.Tokens[1].Kind, KindContinue)
+	require.Equal(t, l.Tokens[1].Value, "continue")
+}
+
+func TestLex_NestedCurlies(t *testing.T) {
+	input := "{{{a: {b: 1}}}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+
+	kinds := make([]Kind, 0, len(l.Tokens))
+	for _, token := range l.Tokens {
+		kinds = append(kinds, token.Kind)
+	}
+
+	require.Equal(t, []Kind{
+		KindLeftDelim,
+		KindOpenCurly, KindIdentifier, KindColon, KindSpace,
+		KindOpenCurly, KindIdentifier, KindColon, KindSpace, KindNumber, KindCloseCurly,
+		KindCloseCurly,
+		KindRightDelim,
+		KindEOF,
+	}, kinds)
+}
+
+func TestLexWithDelimiters(t *testing.T) {
+	l := LexWithDelimiters("Hi {{ <% name %>!", "<%", "%>")
+
+	kinds := make([]Kind, 0, len(l.Tokens))
+	for _, token := range l.Tokens {
+		kinds = append(kinds, token.Kind)
+	}
+
+	require.Equal(t, []Kind{
+		KindText,
+		KindLeftDelim, KindSpace, KindIdentifier, KindSpace, KindRightDelim,
+		KindText,
+		KindEOF,
+	}, kinds)
+
+	require.Equal(t, "Hi {{ ", l.Tokens[0].Value)
+	require.Equal(t, "<%", l.Tokens[1].Value)
+	require.Equal(t, "%>", l.Tokens[5].Value)
+}
+
+func TestLexWithDelimiters_NestedBrackets(t *testing.T) {
+	l := LexWithDelimiters("[[items[0]]]", "[[", "]]")
+
+	kinds := make([]Kind, 0, len(l.Tokens))
+	for _, token := range l.Tokens {
+		kinds = append(kinds, token.Kind)
+	}
+
+	require.Equal(t, []Kind{
+		KindLeftDelim,
+		KindIdentifier, KindOpenBracket, KindNumber, KindCloseBracket,
+		KindRightDelim,
+		KindEOF,
+	}, kinds)
+}
+
+func TestLex_OptionalDot(t *testing.T) {
+	input := "{{user?.Address}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 6)
+
+	require.Equal(t, l.Tokens[2].Kind, KindOptionalDot)
+	require.Equal(t, l.Tokens[2].Value, "?.")
+}
+
+func TestLex_Question(t *testing.T) {
+	input := "{{a ? b : c}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 12)
+
+	require.Equal(t, l.Tokens[3].Kind, KindQuestion)
+	require.Equal(t, l.Tokens[3].Value, "?")
+	require.Equal(t, l.Tokens[7].Kind, KindColon)
+}
+
+func TestLex_NullCoalesce(t *testing.T) {
+	input := "{{a ?? b}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 8)
+
+	require.Equal(t, l.Tokens[3].Kind, KindNullCoalesce)
+	require.Equal(t, l.Tokens[3].Value, "??")
+}
+
+func TestLex_Pipe(t *testing.T) {
+	input := "{{name | upper}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 8)
+
+	require.Equal(t, l.Tokens[3].Kind, KindPipe)
+	require.Equal(t, l.Tokens[3].Value, "|")
+}
+
+func TestLex_DoAndSemicolon(t *testing.T) {
+	input := "{{do a;b}}"
+	l := Lexer{Input: input, Tokens: make([]Token, 0)}
+
+	l.run()
+	require.Len(t, l.Tokens, 8)
+
+	require.Equal(t, l.Tokens[1].Kind, KindDo)
+	require.Equal(t, l.Tokens[1].Value, "do")
+	require.Equal(t, l.Tokens[4].Kind, KindSemicolon)
+	require.Equal(t, l.Tokens[4].Value, ";")
+}
+
+func TestLex_NumberPrefixes(t *testing.T) {
+	for _, number := range []string{"0xFF", "0o17", "0b1010", "1_000"} {
+		l := Lex("{{" + number + "}}")
+
+		require.Len(t, l.Tokens, 4)
+		require.Equal(t, KindNumber, l.Tokens[1].Kind)
+		require.Equal(t, number, l.Tokens[1].Value)
+	}
+}
+
+func TestLex_InvalidNumber(t *testing.T) {
+	l := Lex("hi\n{{ 0xZZ }}")
+
+	token := l.Tokens[len(l.Tokens)-1]
+	require.Equal(t, KindError, token.Kind)
+	require.Equal(t, "invalid number 0xZZ on line 2:\n{{ 0xZZ }}", token.Value)
+}
+
+func TestLex_InvalidUnderscoreNumbers(t *testing.T) {
+	for _, number := range []string{"5_", "1__2", "0x_"} {
+		l := Lex("{{ " + number + " }}")
+
+		token := l.Tokens[len(l.Tokens)-1]
+		require.Equal(t, KindError, token.Kind)
+		require.Equal(t, "invalid number "+number+", underscores must be between digits on line 1:\n{{ "+number+" }}", token.Value)
+	}
+}
+
+func TestLex_UnderscoreIdentifiers(t *testing.T) {
+	for _, name := range []string{"_1", "__", "_"} {
+		l := Lex("{{ " + name + " }}")
+
+		require.Equal(t, KindIdentifier, l.Tokens[2].Kind)
+		require.Equal(t, name, l.Tokens[2].Value)
+	}
+}
+
+func TestLex_LeadingZeroNumbers(t *testing.T) {
+	for _, number := range []string{"010", "08", "00", "0_1"} {
+		l := Lex("{{ " + number + " }}")
+
+		token := l.Tokens[len(l.Tokens)-1]
+		require.Equal(t, KindError, token.Kind)
+		require.Equal(t, "invalid number "+number+", leading zeros are not allowed, use the 0o prefix for octal on line 1:\n{{ "+number+" }}", token.Value)
+	}
+
+	l := Lex("{{0}}")
+	require.Equal(t, KindNumber, l.Tokens[1].Kind)
+}
+
+func TestLex_DefinedAndLogicalOperators(t *testing.T) {
+	l := Lex("{{defined a && b || c & d | e}}")
+
+	kinds := make([]Kind, 0, len(l.Tokens))
+	for _, token := range l.Tokens {
+		kinds = append(kinds, token.Kind)
+	}
+
+	require.Equal(t, []Kind{
+		KindLeftDelim,
+		KindDefined, KindSpace, KindIdentifier, KindSpace,
+		KindAnd, KindSpace, KindIdentifier, KindSpace,
+		KindOr, KindSpace, KindIdentifier, KindSpace,
+		KindAmpersand, KindSpace, KindIdentifier, KindSpace,
+		KindPipe, KindSpace, KindIdentifier,
+		KindRightDelim,
+		KindEOF,
+	}, kinds)
+}
+
+func TestLex_SlotAndYield(t *testing.T) {
+	l := Lex(`{{slot "scripts"}}{{end}}{{yield "scripts"}}`)
+
+	kinds := make([]Kind, 0, len(l.Tokens))
+	for _, token := range l.Tokens {
+		kinds = append(kinds, token.Kind)
+	}
+
+	require.Equal(t, []Kind{
+		KindLeftDelim, KindSlot, KindSpace, KindString, KindRightDelim,
+		KindLeftDelim, KindEnd, KindRightDelim,
+		KindLeftDelim, KindYield, KindSpace, KindString, KindRightDelim,
+		KindEOF,
+	}, kinds)
+}
+
+func TestLex_Raw(t *testing.T) {
+	l := Lex("{{ raw }}{{ name }} {{if}}{{end}}\n{{ end }}{{ raw }}")
+
+	require.Equal(t, []Token{
+		{Kind: KindLeftDelim, Value: "{{", StartLine: 1, EndLine: 1},
+		{Kind: KindSpace, Value: " ", StartLine: 1, EndLine: 1},
+		{Kind: KindRaw, Value: "raw", StartLine: 1, EndLine: 1},
+		{Kind: KindSpace, Value: " ", StartLine: 1, EndLine: 1},
+		{Kind: KindRightDelim, Value: "}}", StartLine: 1, EndLine: 1},
+		{Kind: KindText, Value: "{{ name }} {{if}}{{end}}\n", StartLine: 1, EndLine: 2},
+		{Kind: KindLeftDelim, Value: "{{", StartLine: 2, EndLine: 2},
+		{Kind: KindSpace, Value: " ", StartLine: 2, EndLine: 2},
+		{Kind: KindEnd, Value: "end", StartLine: 2, EndLine: 2},
+		{Kind: KindSpace, Value: " ", StartLine: 2, EndLine: 2},
+		{Kind: KindRightDelim, Value: "}}", StartLine: 2, EndLine: 2},
+		{Kind: KindLeftDelim, Value: "{{", StartLine: 2, EndLine: 2},
+		{Kind: KindSpace, Value: " ", StartLine: 2, EndLine: 2},
+		{Kind: KindRaw, Value: "raw", StartLine: 2, EndLine: 2},
+		{Kind: KindSpace, Value: " ", StartLine: 2, EndLine: 2},
+		{Kind: KindRightDelim, Value: "}}", StartLine: 2, EndLine: 2},
+		{Kind: KindError, Value: "unclosed raw block starting on line 2"},
+	}, l.Tokens)
+}
+
+func TestLex_RawNestedBlocks(t *testing.T) {
+	testCases := map[string]struct {
+		input string
+		text  string
+	}{
+		"if":            {input: `{{ raw }}{{ if }}{{ end }}x{{ end }}`, text: `{{ if }}{{ end }}x`},
+		"if condition":  {input: `{{ raw }}{{ if user }}{{ else }}{{ end }}{{ end }}`, text: `{{ if user }}{{ else }}{{ end }}`},
+		"nested":        {input: `{{ raw }}{{ range $i, $x in xs }}{{ with $x }}{{ end }}{{ end }}{{ end }}`, text: `{{ range $i, $x in xs }}{{ with $x }}{{ end }}{{ end }}`},
+		"raw":           {input: `{{ raw }}{{ raw }}{{ end }}{{ end }}`, text: `{{ raw }}{{ end }}`},
+		"block":         {input: `{{ raw }}{{ block "nav" }}{{ end }}{{ end }}`, text: `{{ block "nav" }}{{ end }}`},
+		"block name":    {input: `{{ raw }}{{ block }}{{ end }}`, text: `{{ block }}`},
+		"switch":        {input: `{{ raw }}{{ switch kind }}{{ case 1 }}{{ end }}{{ end }}`, text: `{{ switch kind }}{{ case 1 }}{{ end }}`},
+		"unclosed text": {input: `{{ raw }}{{ iffy }}{{ end }}`, text: `{{ iffy }}`},
+		"contentFor":    {input: `{{ raw }}{{ contentFor("nav") }}{{ end }}{{ end }}`, text: `{{ contentFor("nav") }}{{ end }}`},
+		"helper call":   {input: `{{ raw }}{{ contentFor("nav", x) }}{{ end }}`, text: `{{ contentFor("nav", x) }}`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			l := Lex(tc.input)
+
+			require.Equal(t, KindText, l.Tokens[5].Kind)
+			require.Equal(t, tc.text, l.Tokens[5].Value)
+			require.Len(t, l.Tokens, 12)
+			require.Equal(t, KindEnd, l.Tokens[8].Kind)
+		})
+	}
+}
+
+func TestLex_RawIdentifier(t *testing.T) {
+	l := Lex("{{ raw.Name }}")
+
+	require.Equal(t, KindIdentifier, l.Tokens[2].Kind)
+	require.Equal(t, "raw", l.Tokens[2].Value)
+}
+
+func TestLex_ContextualKeywords(t *testing.T) {
+	testCases := map[string]struct {
+		input string
+		kind  Kind
+	}{
+		"block":             {input: `{{ block "nav" }}`, kind: KindBlock},
+		"block call":        {input: `{{ block("nav") }}`, kind: KindBlock},
+		"block name":        {input: `{{ block }}`, kind: KindIdentifier},
+		"block access":      {input: `{{ block.Name }}`, kind: KindIdentifier},
+		"block comparison":  {input: `{{ block == "nav" }}`, kind: KindIdentifier},
+		"define":            {input: `{{ define "nav" }}`, kind: KindDefine},
+		"define name":       {input: `{{ define }}`, kind: KindIdentifier},
+		"define expression": {input: `{{ if define }}`, kind: KindIf},
+		"switch":            {input: `{{ switch kind }}`, kind: KindSwitch},
+		"switch name":       {input: `{{ switch }}`, kind: KindIdentifier},
+		"switch operator":   {input: `{{ switch + 1 }}`, kind: KindIdentifier},
+		"case":              {input: `{{ case "a", "b" }}`, kind: KindCase},
+		"case negative":     {input: `{{ case -1 }}`, kind: KindCase},
+		"case name":         {input: `{{ case }}`, kind: KindIdentifier},
+		"case access":       {input: `{{ case.Name }}`, kind: KindIdentifier},
+		"slot":              {input: `{{ slot "head" }}`, kind: KindSlot},
+		"slot name":         {input: `{{ slot }}`, kind: KindIdentifier},
+		"yield":             {input: `{{ yield }}`, kind: KindYield},
+		"yield slot":        {input: `{{ yield("head") }}`, kind: KindYield},
+		"yield access":      {input: `{{ yield.Name }}`, kind: KindIdentifier},
+		"do":                {input: `{{ do track("signup") }}`, kind: KindDo},
+		"do assignment":     {input: `{{ do $step = 2 }}`, kind: KindDo},
+		"do name":           {input: `{{ do }}`, kind: KindIdentifier},
+		"do call":           {input: `{{ do() }}`, kind: KindIdentifier},
+		"capture":           {input: `{{ capture $sidebar }}`, kind: KindCapture},
+		"capture name":      {input: `{{ capture }}`, kind: KindIdentifier},
+		"capture access":    {input: `{{ capture.Name }}`, kind: KindIdentifier},
+		"capture compare":   {input: `{{ capture == 1 }}`, kind: KindIdentifier},
+		"defined":           {input: `{{ defined $user }}`, kind: KindDefined},
+		"defined name":      {input: `{{ defined }}`, kind: KindIdentifier},
+		"defined access":    {input: `{{ defined.Name }}`, kind: KindIdentifier},
+		"defined in":        {input: `{{ defined in list }}`, kind: KindIdentifier},
+		"break":             {input: `{{ break }}`, kind: KindBreak},
+		"break access":      {input: `{{ break.Name }}`, kind: KindIdentifier},
+		"break expression":  {input: `{{ break + 1 }}`, kind: KindIdentifier},
+		"continue":          {input: `{{ continue }}`, kind: KindContinue},
+		"continue access":   {input: `{{ continue.Name }}`, kind: KindIdentifier},
+		"with":              {input: `{{ with user }}`, kind: KindWith},
+		"with assignment":   {input: `{{ with $u = user }}`, kind: KindWith},
+		"with name":         {input: `{{ with }}`, kind: KindIdentifier},
+		"with access":       {input: `{{ with.X }}`, kind: KindIdentifier},
+		"let":               {input: `{{ let $total = 1 }}`, kind: KindLet},
+		"let name":          {input: `{{ let }}`, kind: KindIdentifier},
+		"let access":        {input: `{{ let.Name }}`, kind: KindIdentifier},
+		"let identifier":    {input: `{{ let total = 1 }}`, kind: KindIdentifier},
+		"contentFor":        {input: `{{ contentFor "head" }}`, kind: KindSlot},
+		"contentFor call":   {input: `{{ contentFor("head") }}`, kind: KindSlot},
+		"contentFor name":   {input: `{{ contentFor }}`, kind: KindIdentifier},
+		"contentFor access": {input: `{{ contentFor.Name }}`, kind: KindIdentifier},
+		"contentFor helper": {input: `{{ contentFor("head", safe("<b>")) }}`, kind: KindIdentifier},
+		"contentFor comma":  {input: `{{ contentFor(join([a, b], ",")) }}`, kind: KindSlot},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			l := Lex(tc.input)
+			require.Equal(t, tc.kind, l.Tokens[2].Kind)
+		})
+	}
+}
+
+func TestLex_Unclosed(t *testing.T) {
+	testCases := map[string]struct {
+		input string
+		err   string
+	}{
+		"action": {input: "a\n\n<p>{{ name", err: "unclosed {{ opened on line 3:\n<p>{{ name"},
+		"string": {input: "{{ \"hello }}", err: "unclosed string opened on line 1:\n{{ \"hello }}"},
+		"map":    {input: "{{ {a: 1", err: "unclosed { opened on line 1:\n{{ {a: 1"},
+		"parens": {input: "{{ foo(1,\n2", err: "unclosed ( opened on line 1:\n{{ foo(1,"},
+		"empty":  {input: "{{", err: "unclosed {{ opened on line 1:\n{{"},
+		"custom": {input: "<% name", err: "unclosed <% opened on line 1:\n<% name"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var l *Lexer
+			if name == "custom" {
+				l = LexWithDelimiters(tc.input, "<%", "%>")
+			} else {
+				l = Lex(tc.input)
+			}
+
+			last := l.Tokens[len(l.Tokens)-1]
+			require.Equal(t, KindError, last.Kind)
+			require.Equal(t, tc.err, last.Value)
+		})
+	}
+}
@@ -41,6 +41,30 @@ const (
 	KindCloseBracket
 	KindOpenAngle
 	KindCloseAngle
+	KindDotDot
+	KindBreak
+	KindContinue
+	KindLet
+	KindWith
+	KindOptionalDot
+	KindQuestion
+	KindNullCoalesce
+	KindPipe
+	KindDo
+	KindSemicolon
+	KindSwitch
+	KindCase
+	KindAmpersand
+	KindCaret
+	KindDefined
+	KindAnd
+	KindOr
+	KindSlot
+	KindYield
+	KindCapture
+	KindRaw
+	KindBlock
+	KindDefine
 )
 
 type Token struct {
@@ -126,6 +150,54 @@ func (k Kind) String() string {
 		return "openAngle"
 	case KindCloseAngle:
 		return "closeAngle"
+	case KindDotDot:
+		return "dotDot"
+	case KindBreak:
+		return "break"
+	case KindContinue:
+		return "continue"
+	case KindLet:
+		return "let"
+	case KindWith:
+		return "with"
+	case KindOptionalDot:
+		return "optionalDot"
+	case KindQuestion:
+		return "question"
+	case KindNullCoalesce:
+		return "nullCoalesce"
+	case KindPipe:
+		return "pipe"
+	case KindDo:
+		return "do"
+	case KindSemicolon:
+		return "semicolon"
+	case KindSwitch:
+		return "switch"
+	case KindCase:
+		return "case"
+	case KindAmpersand:
+		return "ampersand"
+	case KindCaret:
+		return "caret"
+	case KindDefined:
+		return "defined"
+	case KindAnd:
+		return "and"
+	case KindOr:
+		return "or"
+	case KindSlot:
+		return "slot"
+	case KindYield:
+		return "yield"
+	case KindCapture:
+		return "capture"
+	case KindRaw:
+		return "raw"
+	case KindBlock:
+		return "block"
+	case KindDefine:
+		return "define"
 	default:
 		return fmt.Sprintf("unknown %d", k)
 	}
@@ -134,3 +206,18 @@ func (k Kind) String() string {
 func (t Token) String() string {
 	return fmt.Sprintf("{%s `%s`}", t.Kind, t.Value)
 }
+
+// IsKeyword returns true if tokens of the kind are keywords, e.g. KindIf.
+func (k Kind) IsKeyword() bool {
+	if k == KindRaw {
+		return true
+	}
+
+	for _, kind := range keywords {
+		if kind == k {
+			return true
+		}
+	}
+
+	return false
+}
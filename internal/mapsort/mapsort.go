@@ -18,14 +18,14 @@ func Sort(v reflect.Value) Map {
 		Values: make([]reflect.Value, 0, len),
 	}
 
-	keyType := reflect.TypeOf(v.Interface()).Key()
+	keyType := v.Type().Key()
 	keys := v.MapKeys()
 
 	if keyType.Comparable() {
 		switch keyType.String() {
 		case "string":
 			sort.SliceStable(keys, func(a int, b int) bool {
-				return keys[a].Interface().(string) < keys[b].Interface().(string)
+				return keys[a].String() < keys[b].String()
 			})
 		}
 	}
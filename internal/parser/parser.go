@@ -21,6 +21,12 @@ type parser struct {
 	lexer *lexer.Lexer
 	Root  *Node
 	pos   int
+	// rangeDepth tracks how many range bodies are being parsed so that break
+	// and continue can only be used inside of a range.
+	rangeDepth int
+	// withDepth tracks how many with bodies are being parsed so that `.` can
+	// only be used inside of a with.
+	withDepth int
 }
 
 const (
@@ -60,6 +66,9 @@ const (
 	// If range has 3 children, the first child will be the index or key, the
 	// second child will be the value to iterate over, and the third child will
 	// be the code to execute for each iteration.
+	//
+	// If range has an else clause, the code to execute when there are no
+	// iterations is appended as the last child.
 	KindRange = "range"
 	// KindVariable represents a variable. (e.g. "$foo")
 	KindVariable = "variable"
@@ -75,14 +84,98 @@ const (
 	KindCall = "call"
 	// KindMap represents a map literal (e.g. "{foo: bar}")
 	KindMap = "map"
-	// KindPair represents a key/value pair in a map literal (e.g. "foo: bar")
+	// KindList represents a list literal (e.g. `["foo", bar]`)
+	KindList = "list"
+	// KindPair represents a key/value pair in a map literal (e.g. "foo: bar").
+	// The key is either a KindIdentifier, KindString, or KindComputedKey.
 	KindPair = "pair"
+	// KindIntRange represents a range of integers used by range statements
+	// (e.g. "1..10"). The first child is the start of the range (inclusive) and
+	// the second child is the end of the range (exclusive).
+	KindIntRange = "int_range"
+	// KindComputedKey represents a map literal key that is computed from an
+	// expression (e.g. "(foo): bar"). The only child is the expression.
+	KindComputedKey = "computed_key"
 	// KindBracketAccess represents an access to a value in a map literal (e.g. "foo[bar]" or "foo["bar"]")
 	KindBracketAccess = "bracket_access"
+	// KindSlice represents a slice expression (e.g. "foo[1:3]"). The first
+	// child is the value being sliced, the second child is the low bound, and
+	// the third child is the high bound. Omitted bounds are nil.
+	KindSlice = "slice"
 	// KindNot represents a not expression (e.g. "!foo")
 	KindNot = "not"
+	// KindAssign represents a variable assignment (e.g. "$foo = bar" or
+	// "let $foo = bar"). The first child is the variable being assigned, the
+	// second child is the value.
+	KindAssign = "assign"
+	// KindBreak represents a break statement, which stops the innermost range
+	// from iterating.
+	KindBreak = "break"
+	// KindWith represents a with statement, which evaluates the code in its
+	// block with the value of an expression as the current context. The first
+	// child is the expression or an assignment of it, the second child is the code executed when the
+	// expression isn't nil, and the third child (if present) is the code
+	// executed when it is nil.
+	KindWith = "with"
+	// KindContext represents the current context of a with or range statement (e.g.
+	// "." or the "." in ".City").
+	KindContext = "context"
+	// KindContinue represents a continue statement, which skips the rest of
+	// the current iteration of the innermost range.
+	KindContinue = "continue"
+	// KindTernary represents a conditional expression, which has the
+	// condition, the value when truthy, and the value when falsy as children
+	// (e.g. "foo ? bar : baz")
+	KindTernary = "ternary"
+	// KindNullCoalesce represents a default value for nil values, which has
+	// the value and the default as children (e.g. "foo ?? bar")
+	KindNullCoalesce = "nullCoalesce"
+	// KindDo represents a do statement, which evaluates its children without
+	// output (e.g. "do foo(); bar()")
+	KindDo = "do"
+	// KindSwitch represents a switch statement, which has the value being
+	// switched on, the cases, and an optional else block as children (e.g.
+	// "switch foo")
+	KindSwitch = "switch"
+	// KindCase represents a case of a switch statement, which has the values
+	// to compare against followed by the block to execute as children (e.g.
+	// "case "a", "b"")
+	KindCase = "case"
+	// KindDefined represents a check for whether data or a variable is
+	// defined, which has the identifier or variable as a child (e.g.
+	// "defined foo")
+	KindDefined = "defined"
+	// KindSlot represents a named slot, which captures its block so a layout
+	// can yield it. The first child is the name, the second is the block (e.g.
+	// "slot "scripts"" or "contentFor("scripts")")
+	KindSlot = "slot"
+	// KindYield represents the output of a named slot, or the child content
+	// when it has no children (e.g. "yield "scripts"" or "yield")
+	KindYield = "yield"
+	// KindCapture represents a capture statement, which renders its block and
+	// assigns the output to a variable. The first child is the variable, the
+	// second is the block (e.g. "capture $sidebar")
+	KindCapture = "capture"
+	// KindRaw represents a raw block, which has its content as the value and
+	// outputs it without evaluating it (e.g. "raw")
+	KindRaw = "raw"
+	// KindBlockDef represents a named block of a layout, which is replaced by
+	// the child template's definition of the block, if any. The first child is
+	// the name, the second is the default block (e.g. "block "sidebar"")
+	KindBlockDef = "block_def"
+	// KindDefine represents the definition of a named block, which overrides
+	// the block in layouts. The first child is the name, the second is the
+	// block (e.g. "define "sidebar"")
+	KindDefine = "define"
+	// KindLimit represents the maximum number of iterations of a range
+	// statement (e.g. "limit 5"). The only child is the limit expression.
+	KindLimit = "limit"
 )
 
+// OptionalAccess is the value of KindAccess nodes that are nil-safe, e.g. the
+// access of "bar" in "foo?.bar".
+const OptionalAccess = "?."
+
 // String() prints the AST in a typical s-expression format for easy
 // reading/debugging.
 func (n *Node) String() string {
@@ -96,7 +189,11 @@ func (n *Node) String() string {
 		out += "\n"
 
 		for i, child := range n.Children {
-			str := child.String()
+			str := "(omitted)"
+			if child != nil {
+				str = child.String()
+			}
+
 			str = "   " + strings.Join(strings.Split(str, "\n"), "\n   ")
 			out += str
 
@@ -146,6 +243,12 @@ func Parse(l *lexer.Lexer) (_ *Node, err error) {
 		}
 	}()
 
+	// The lexer stops at the first error it finds, which is more helpful
+	// than the parse error it would cause.
+	if len(l.Tokens) > 0 && l.Tokens[len(l.Tokens)-1].Kind == lexer.KindError {
+		return nil, errors.New(l.Tokens[len(l.Tokens)-1].Value)
+	}
+
 	p := &parser{
 		lexer: l,
 		Root:  &Node{Kind: KindRoot},
@@ -154,6 +257,11 @@ func Parse(l *lexer.Lexer) (_ *Node, err error) {
 
 	p.Root.Children = parseMany(p)
 
+	// parseMany stops at else and end, which are only valid inside of a block
+	if p.peek().Kind != lexer.KindEOF {
+		p.errorWithLoc("unexpected `%s` without a matching block", p.peek().Value)
+	}
+
 	return p.Root, err
 }
 
@@ -173,22 +281,17 @@ func parseMany(p *parser) []*Node {
 
 			p.skipWhitespace()
 
-			// else and end signify the end of the current statement, so exit
+			// else, end, and case signify the end of the current statement, so exit
 			switch p.peek().Kind {
 			case lexer.KindElse:
 				return nodes
 			case lexer.KindEnd:
 				return nodes
+			case lexer.KindCase:
+				return nodes
 			case lexer.KindSlash:
-				p.expect(lexer.KindSlash)
-
-				for {
-					token := p.next()
-					if token.Kind == lexer.KindRightDelim {
-						p.next()
-						return nodes
-					}
-				}
+				p.skipComment()
+				continue
 			}
 
 			// parse everything between {{ and }}
@@ -198,15 +301,8 @@ func parseMany(p *parser) []*Node {
 			p.skipWhitespace()
 
 			if p.peek().Kind == lexer.KindSlash {
-				p.expect(lexer.KindSlash)
-
-				for {
-					token := p.next()
-					if token.Kind == lexer.KindRightDelim {
-						p.next()
-						return nodes
-					}
-				}
+				p.skipComment()
+				continue
 			}
 
 			p.expect(lexer.KindRightDelim)
@@ -214,6 +310,8 @@ func parseMany(p *parser) []*Node {
 			return nodes
 		case lexer.KindEnd:
 			return nodes
+		case lexer.KindCase:
+			return nodes
 		default:
 			p.errorWithLoc("unsupported token %v", p.peek().Value)
 		}
@@ -229,7 +327,14 @@ func parseStatement(p *parser) *Node {
 		p.next()
 	case lexer.KindEOF:
 		panic("unexpected EOF")
-	case lexer.KindOpenCurly, lexer.KindIdentifier, lexer.KindVariable, lexer.KindNumber, lexer.KindMinus, lexer.KindString, lexer.KindBang:
+	case lexer.KindIdentifier, lexer.KindVariable:
+		if p.isAssignment() {
+			return parseAssignment(p)
+		}
+
+		return parseExpression(p, true)
+	case lexer.KindOpenCurly, lexer.KindOpenBracket, lexer.KindNumber, lexer.KindMinus, lexer.KindString, lexer.KindBang, lexer.KindDot,
+		lexer.KindDefined:
 		return parseExpression(p, true)
 	case lexer.KindNil:
 		token := p.next()
@@ -241,12 +346,220 @@ func parseStatement(p *parser) *Node {
 		return parseIf(p)
 	case lexer.KindRange:
 		return parseRange(p)
+	case lexer.KindWith:
+		return parseWith(p)
+	case lexer.KindSwitch:
+		return parseSwitch(p)
+	case lexer.KindDo:
+		return parseDo(p)
+	case lexer.KindSlot:
+		return parseNamedBlock(p, lexer.KindSlot, KindSlot)
+	case lexer.KindYield:
+		return parseYield(p)
+	case lexer.KindCapture:
+		return parseCapture(p)
+	case lexer.KindRaw:
+		return parseRaw(p)
+	case lexer.KindBlock:
+		return parseNamedBlock(p, lexer.KindBlock, KindBlockDef)
+	case lexer.KindDefine:
+		return parseNamedBlock(p, lexer.KindDefine, KindDefine)
+	case lexer.KindLet:
+		p.expect(lexer.KindLet)
+		p.expect(lexer.KindSpace)
+		p.skipWhitespace()
+
+		if !p.isAssignment() {
+			p.errorWithLoc("expected assignment after `let`")
+		}
+
+		return parseAssignment(p)
+	case lexer.KindBreak:
+		token := p.next()
+
+		// Outside of a range, `{{ break }}` renders data named break
+		if p.rangeDepth == 0 {
+			return &Node{Kind: KindIdentifier, Value: token.Value, StartLine: token.StartLine, EndLine: token.EndLine}
+		}
+
+		return &Node{Kind: KindBreak, StartLine: token.StartLine, EndLine: token.EndLine}
+	case lexer.KindContinue:
+		token := p.next()
+
+		// Outside of a range, `{{ continue }}` renders data named continue
+		if p.rangeDepth == 0 {
+			return &Node{Kind: KindIdentifier, Value: token.Value, StartLine: token.StartLine, EndLine: token.EndLine}
+		}
+
+		return &Node{Kind: KindContinue, StartLine: token.StartLine, EndLine: token.EndLine}
 	default:
 		p.errorWithLoc("unexpected token %v", p.peek().Value)
 	}
 	return nil
 }
 
+// parses do statements, which evaluate one or more `;` separated expressions
+// or assignments without output, e.g. `do track("view"); $count = 1;`
+func parseDo(p *parser) *Node {
+	token := p.expect(lexer.KindDo)
+	node := &Node{Kind: KindDo, StartLine: token.StartLine, EndLine: token.EndLine}
+
+	for {
+		p.skipWhitespace()
+
+		// Each statement after the first can optionally repeat `do`
+		if len(node.Children) > 0 && p.peek().Kind == lexer.KindDo {
+			p.next()
+			p.skipWhitespace()
+		}
+
+		var child *Node
+		if p.isAssignment() {
+			child = parseAssignment(p)
+		} else {
+			child = parseExpression(p, true)
+		}
+
+		node.Children = append(node.Children, child)
+		node.EndLine = child.EndLine
+		p.skipWhitespace()
+
+		if p.peek().Kind != lexer.KindSemicolon {
+			return node
+		}
+
+		p.expect(lexer.KindSemicolon)
+		p.skipWhitespace()
+
+		// Trailing semicolons are allowed
+		if p.peek().Kind == lexer.KindRightDelim {
+			return node
+		}
+	}
+}
+
+// parses a keyword followed by a name and a block, e.g. a slot like
+// `slot "scripts"` or `contentFor("scripts")`, or a block definition like
+// `define "sidebar"`
+func parseNamedBlock(p *parser, keyword lexer.Kind, kind string) *Node {
+	token := p.expect(keyword)
+	node := &Node{Kind: kind, StartLine: token.StartLine, EndLine: token.EndLine}
+
+	if p.peek().Kind == lexer.KindOpenParen {
+		p.expect(lexer.KindOpenParen)
+		p.skipWhitespace()
+		node.Children = append(node.Children, parseExpression(p, true))
+		p.skipWhitespace()
+		p.expect(lexer.KindCloseParen)
+	} else {
+		p.expect(lexer.KindSpace)
+		p.skipWhitespace()
+		node.Children = append(node.Children, parseExpression(p, true))
+	}
+
+	p.skipWhitespace()
+	p.expect(lexer.KindRightDelim)
+
+	node.Children = append(node.Children, parseBlock(p))
+	p.skipWhitespace()
+	p.expect(lexer.KindEnd)
+
+	return node
+}
+
+// parses a capture statement and its block, e.g. `capture $sidebar`
+func parseCapture(p *parser) *Node {
+	token := p.expect(lexer.KindCapture)
+	node := &Node{Kind: KindCapture, StartLine: token.StartLine, EndLine: token.EndLine}
+
+	p.expect(lexer.KindSpace)
+	p.skipWhitespace()
+
+	if p.peek().Kind != lexer.KindVariable {
+		p.errorWithLoc("expected variable after `capture`, got `%s`", p.peek().Value)
+	}
+
+	variable := p.next()
+	node.Children = append(node.Children, &Node{
+		Kind:      KindVariable,
+		Value:     variable.Value,
+		StartLine: variable.StartLine,
+		EndLine:   variable.EndLine,
+	})
+	p.skipWhitespace()
+	p.expect(lexer.KindRightDelim)
+
+	node.Children = append(node.Children, parseBlock(p))
+	p.skipWhitespace()
+	p.expect(lexer.KindEnd)
+
+	return node
+}
+
+// parses a raw block, whose content is output as-is, e.g. `raw`
+func parseRaw(p *parser) *Node {
+	token := p.expect(lexer.KindRaw)
+	node := &Node{Kind: KindRaw, StartLine: token.StartLine, EndLine: token.EndLine}
+
+	p.skipWhitespace()
+	p.expect(lexer.KindRightDelim)
+
+	if p.peek().Kind == lexer.KindText {
+		text := p.next()
+		node.Value = text.Value
+		node.EndLine = text.EndLine
+	}
+
+	p.expect(lexer.KindLeftDelim)
+	p.skipWhitespace()
+	p.expect(lexer.KindEnd)
+
+	return node
+}
+
+// parses the output of a slot, e.g. `yield "scripts"`, `yield("scripts")`, or
+// `yield` for the child content
+func parseYield(p *parser) *Node {
+	token := p.expect(lexer.KindYield)
+	node := &Node{Kind: KindYield, StartLine: token.StartLine, EndLine: token.EndLine}
+
+	if p.peek().Kind == lexer.KindOpenParen {
+		p.expect(lexer.KindOpenParen)
+		p.skipWhitespace()
+		node.Children = append(node.Children, parseExpression(p, true))
+		p.skipWhitespace()
+		end := p.expect(lexer.KindCloseParen)
+		node.EndLine = end.EndLine
+
+		return node
+	}
+
+	p.skipWhitespace()
+	if p.peek().Kind == lexer.KindRightDelim {
+		return node
+	}
+
+	name := parseExpression(p, true)
+	node.Children = append(node.Children, name)
+	node.EndLine = name.EndLine
+
+	return node
+}
+
+// skipComment skips over a `// comment` through the closing delimiter.
+func (p *parser) skipComment() {
+	p.expect(lexer.KindSlash)
+
+	for {
+		switch p.next().Kind {
+		case lexer.KindRightDelim:
+			return
+		case lexer.KindEOF:
+			p.panicWithMessage("unexpected EOF in comment")
+		}
+	}
+}
+
 func (p *parser) errorWithLoc(msg string, formatting ...any) {
 	formatted := fmt.Sprintf(msg, formatting...)
 	formatted += fmt.Sprintf(": on line %d", p.peek().StartLine)
@@ -254,10 +567,135 @@ func (p *parser) errorWithLoc(msg string, formatting ...any) {
 	panic(formatted)
 }
 
-// parses expressions, like:
+// parses expressions, including ternaries, like:
 // foo.bar.baz
 // foo != nil
+// foo ? bar : baz
 func parseExpression(p *parser, allowOperator bool) *Node {
+	node := parseNullCoalesce(p, allowOperator)
+
+	if !allowOperator || p.peek().Kind != lexer.KindQuestion {
+		return node
+	}
+
+	return parseTernary(p, node)
+}
+
+// parses operations joined by `??`, e.g. `foo ?? bar ?? "baz"`. `??` has a
+// lower precedence than every other operator, except for ternaries.
+func parseNullCoalesce(p *parser, allowOperator bool) *Node {
+	node := parseOr(p, allowOperator)
+
+	for allowOperator && p.peek().Kind == lexer.KindNullCoalesce {
+		p.expect(lexer.KindNullCoalesce)
+		p.skipWhitespace()
+		right := parseOr(p, true)
+
+		node = &Node{
+			Kind:      KindNullCoalesce,
+			Children:  []*Node{node, right},
+			StartLine: node.StartLine,
+			EndLine:   right.EndLine,
+		}
+	}
+
+	return node
+}
+
+// parses operations joined by `||`, e.g. `foo || bar`
+func parseOr(p *parser, allowOperator bool) *Node {
+	return parseLogical(p, allowOperator, lexer.KindOr, parseAnd)
+}
+
+// parses operations joined by `&&`, e.g. `foo && bar`, which has a higher
+// precedence than `||`.
+func parseAnd(p *parser, allowOperator bool) *Node {
+	return parseLogical(p, allowOperator, lexer.KindAnd, parsePipeline)
+}
+
+// parseLogical parses operands joined by the given logical operator, using
+// parseOperand to parse the operations with a higher precedence.
+func parseLogical(p *parser, allowOperator bool, kind lexer.Kind, parseOperand func(*parser, bool) *Node) *Node {
+	node := parseOperand(p, allowOperator)
+
+	for allowOperator && p.peek().Kind == kind {
+		token := p.expect(kind)
+		p.skipWhitespace()
+		right := parseOperand(p, true)
+
+		node = &Node{
+			Kind: KindInfix,
+			Children: []*Node{
+				node,
+				{Kind: KindOperator, Value: token.Value, StartLine: token.StartLine, EndLine: token.EndLine},
+				right,
+			},
+			StartLine: node.StartLine,
+			EndLine:   right.EndLine,
+		}
+	}
+
+	return node
+}
+
+// parses operations piped into helpers, e.g. `name | trim | upper`. The
+// left side of each pipe becomes the first argument of the helper on the
+// right, so `price | format("%.2f")` is the same as `format(price, "%.2f")`.
+func parsePipeline(p *parser, allowOperator bool) *Node {
+	node := parseOperation(p, allowOperator)
+
+	for allowOperator && p.peek().Kind == lexer.KindPipe {
+		p.expect(lexer.KindPipe)
+		p.skipWhitespace()
+		right := parseOperation(p, false)
+
+		switch right.Kind {
+		case KindIdentifier, KindAccess:
+			node = &Node{
+				Kind:      KindCall,
+				Children:  []*Node{right, node},
+				StartLine: node.StartLine,
+				EndLine:   right.EndLine,
+			}
+		case KindCall:
+			args := append([]*Node{node}, right.Children[1:]...)
+			right.Children = append([]*Node{right.Children[0]}, args...)
+			right.StartLine = node.StartLine
+			node = right
+		case KindInt:
+			p.errorWithLoc("expected function after `|`, got %s, use bitor for bitwise or", right.Kind)
+		default:
+			p.errorWithLoc("expected function after `|`, got %s", right.Kind)
+		}
+	}
+
+	return node
+}
+
+// parses the branches of a ternary after its condition, e.g. `? bar : baz`.
+// Both branches accept full expressions, so nested ternaries are
+// right-associative: `a ? b : c ? d : e` is parsed as `a ? b : (c ? d : e)`.
+func parseTernary(p *parser, condition *Node) *Node {
+	p.expect(lexer.KindQuestion)
+	p.skipWhitespace()
+	whenTrue := parseExpression(p, true)
+	p.skipWhitespace()
+	p.expect(lexer.KindColon)
+	p.skipWhitespace()
+	whenFalse := parseExpression(p, true)
+
+	return &Node{
+		Kind:      KindTernary,
+		Children:  []*Node{condition, whenTrue, whenFalse},
+		StartLine: condition.StartLine,
+		EndLine:   whenFalse.EndLine,
+	}
+}
+
+// parses operations without ternaries, like:
+// foo.bar.baz
+// foo != nil
+func parseOperation(p *parser, allowOperator bool) *Node {
 	var rootNode *Node
 
 	wrapInNot := false
@@ -269,21 +707,30 @@ func parseExpression(p *parser, allowOperator bool) *Node {
 	if p.peek().Kind == lexer.KindOpenCurly {
 		p.expect(lexer.KindOpenCurly)
 		rootNode = parseMap(p)
+	} else if p.peek().Kind == lexer.KindOpenBracket {
+		p.expect(lexer.KindOpenBracket)
+		rootNode = parseList(p)
 	} else {
 		rootNode = parseLiteralOrAccess(p)
 	}
 
 	p.skipWhitespace()
 
-	if p.peek().Kind == lexer.KindDot || p.peek().Kind == lexer.KindOpenParen || p.peek().Kind == lexer.KindOpenBracket {
+	switch p.peek().Kind {
+	case lexer.KindDot, lexer.KindOptionalDot, lexer.KindOpenParen, lexer.KindOpenBracket:
 		node := rootNode
+		// Once `?.` is used, the rest of the property accesses in the chain
+		// are also nil-safe so that nil propagates to the end of the chain.
+		optional := false
 
 	loop:
 		for {
 			switch p.peek().Kind {
-			case lexer.KindDot:
-				p.expect(lexer.KindDot)
-				childNode := parseVariable(p)
+			case lexer.KindDot, lexer.KindOptionalDot:
+				if p.next().Kind == lexer.KindOptionalDot {
+					optional = true
+				}
+				childNode := parseProperty(p)
 
 				newNode := &Node{
 					Kind:      KindAccess,
@@ -292,18 +739,31 @@ func parseExpression(p *parser, allowOperator bool) *Node {
 					EndLine:   childNode.EndLine,
 				}
 
+				if optional {
+					newNode.Value = OptionalAccess
+				}
+
 				node = newNode
 			case lexer.KindOpenBracket:
 				p.expect(lexer.KindOpenBracket)
+				p.skipWhitespace()
+
+				var low *Node
+				if p.peek().Kind != lexer.KindColon {
+					low = parseExpression(p, true)
+				}
+
+				if p.peek().Kind == lexer.KindColon {
+					node = parseSlice(p, node, low)
+					continue
+				}
 
 				newNode := &Node{
 					Kind:      KindBracketAccess,
-					Children:  []*Node{node},
+					Children:  []*Node{node, low},
 					StartLine: rootNode.StartLine,
 				}
 
-				child := parseExpression(p, true)
-				newNode.Children = append(newNode.Children, child)
 				p.expect(lexer.KindCloseBracket)
 
 				node = newNode
@@ -377,7 +837,8 @@ func parseExpression(p *parser, allowOperator bool) *Node {
 		if p.peekn(2).Kind == lexer.KindSlash {
 			return rootNode
 		}
-	case lexer.KindPlus, lexer.KindAsterisk, lexer.KindPercent, lexer.KindCloseAngle, lexer.KindOpenAngle:
+	case lexer.KindPlus, lexer.KindAsterisk, lexer.KindPercent, lexer.KindCloseAngle, lexer.KindOpenAngle, lexer.KindIn,
+		lexer.KindAmpersand, lexer.KindCaret:
 		// do nothing, fall through to parse operator
 	default:
 		return rootNode
@@ -405,6 +866,26 @@ func parseExpression(p *parser, allowOperator bool) *Node {
 	return node
 }
 
+// parses the remainder of a slice expression after the low bound, e.g. `:3]`
+func parseSlice(p *parser, root *Node, low *Node) *Node {
+	p.expect(lexer.KindColon)
+	p.skipWhitespace()
+
+	var high *Node
+	if p.peek().Kind != lexer.KindCloseBracket {
+		high = parseExpression(p, true)
+	}
+
+	end := p.expect(lexer.KindCloseBracket)
+
+	return &Node{
+		Kind:      KindSlice,
+		Children:  []*Node{root, low, high},
+		StartLine: root.StartLine,
+		EndLine:   end.EndLine,
+	}
+}
+
 func parseLiteralOrAccess(p *parser) *Node {
 	kind := KindIdentifier
 	switch p.peek().Kind {
@@ -447,6 +928,10 @@ func parseLiteralOrAccess(p *parser) *Node {
 		kind = KindInt
 	case lexer.KindVariable, lexer.KindIdentifier:
 		return parseVariable(p)
+	case lexer.KindDot:
+		return parseContext(p)
+	case lexer.KindDefined:
+		return parseDefined(p)
 	default:
 		p.panicWithMessage(fmt.Sprintf("Unexpected identifier %s", p.peek().Kind.String()))
 	}
@@ -465,6 +950,70 @@ func parseLiteralOrAccess(p *parser) *Node {
 	return identifierNode
 }
 
+// parses a check for whether data or a variable is defined, e.g.
+// `defined foo` or `defined $foo`
+func parseDefined(p *parser) *Node {
+	token := p.expect(lexer.KindDefined)
+	p.expect(lexer.KindSpace)
+	p.skipWhitespace()
+
+	if kind := p.peek().Kind; kind != lexer.KindIdentifier && kind != lexer.KindVariable {
+		p.errorWithLoc("expected identifier or variable after `defined`, got `%s`", p.peek().Value)
+	}
+
+	name := parseVariable(p)
+	p.skipWhitespace()
+
+	return &Node{
+		Kind:      KindDefined,
+		Children:  []*Node{name},
+		StartLine: token.StartLine,
+		EndLine:   name.EndLine,
+	}
+}
+
+// parses the current context of a with or range statement, e.g. `.` or
+// `.City`
+func parseContext(p *parser) *Node {
+	if p.withDepth == 0 && p.rangeDepth == 0 {
+		p.errorWithLoc("`.` can only be used inside of with or range")
+	}
+
+	token := p.expect(lexer.KindDot)
+	node := &Node{Kind: KindContext, Value: ".", StartLine: token.StartLine, EndLine: token.EndLine}
+
+	if p.peek().Kind != lexer.KindIdentifier && !p.peek().Kind.IsKeyword() {
+		p.skipWhitespace()
+		return node
+	}
+
+	property := parseProperty(p)
+
+	return &Node{
+		Kind:      KindAccess,
+		Children:  []*Node{node, property},
+		StartLine: property.StartLine,
+		EndLine:   property.EndLine,
+	}
+}
+
+// parseProperty parses the name of a property after `.` or `?.`. Keywords are
+// allowed since they can't start a statement there, e.g. `page.block`.
+func parseProperty(p *parser) *Node {
+	if !p.peek().Kind.IsKeyword() {
+		return parseVariable(p)
+	}
+
+	token := p.next()
+
+	return &Node{
+		Kind:      KindIdentifier,
+		Value:     token.Value,
+		StartLine: token.StartLine,
+		EndLine:   token.EndLine,
+	}
+}
+
 func parseVariable(p *parser) *Node {
 	identifierToken := p.next()
 
@@ -551,6 +1100,107 @@ func parseIf(p *parser) *Node {
 	return node
 }
 
+func parseSwitch(p *parser) *Node {
+	node := &Node{
+		Kind:      KindSwitch,
+		StartLine: p.peek().StartLine,
+		EndLine:   p.peek().EndLine,
+	}
+
+	p.expect(lexer.KindSwitch)
+	p.expect(lexer.KindSpace)
+	p.skipWhitespace()
+
+	node.Children = append(node.Children, parseExpression(p, true))
+	p.skipWhitespace()
+	p.expect(lexer.KindRightDelim)
+
+	// Only whitespace is allowed between the switch and the first case
+	for _, child := range parseMany(p) {
+		if child.Kind != KindText || strings.TrimSpace(child.Value) != "" {
+			p.errorWithLoc("unexpected content before first `case`")
+		}
+	}
+
+	for p.peek().Kind == lexer.KindCase {
+		node.Children = append(node.Children, parseCase(p))
+	}
+
+	if p.peek().Kind == lexer.KindElse {
+		p.expect(lexer.KindElse)
+		p.skipWhitespace()
+		p.expect(lexer.KindRightDelim)
+		// default case, for when no cases match
+		node.Children = append(node.Children, parseBlock(p))
+		p.skipWhitespace()
+
+		if p.peek().Kind == lexer.KindCase {
+			p.errorWithLoc("unexpected `case` after `else`")
+		}
+	}
+
+	p.expect(lexer.KindEnd)
+
+	return node
+}
+
+// parses a case of a switch statement and its block, e.g. `case "a", "b"`
+func parseCase(p *parser) *Node {
+	token := p.expect(lexer.KindCase)
+	node := &Node{Kind: KindCase, StartLine: token.StartLine, EndLine: token.EndLine}
+
+	p.expect(lexer.KindSpace)
+
+	for {
+		p.skipWhitespace()
+		node.Children = append(node.Children, parseExpression(p, true))
+		p.skipWhitespace()
+
+		if p.peek().Kind != lexer.KindComma {
+			break
+		}
+
+		p.expect(lexer.KindComma)
+	}
+
+	p.expect(lexer.KindRightDelim)
+	node.Children = append(node.Children, parseBlock(p))
+	p.skipWhitespace()
+
+	return node
+}
+
+// isAssignment returns true if the upcoming tokens look like `foo = bar`,
+// which is distinct from `foo == bar`.
+func (p *parser) isAssignment() bool {
+	i := 2
+	for p.peekn(i).Kind == lexer.KindSpace {
+		i++
+	}
+
+	return p.peekn(i).Kind == lexer.KindEqual && p.peekn(i+1).Kind != lexer.KindEqual
+}
+
+func parseAssignment(p *parser) *Node {
+	if p.peek().Kind != lexer.KindVariable {
+		p.errorWithLoc("can't assign to `%s`, variables must start with $", p.peek().Value)
+	}
+
+	variable := parseVariable(p)
+	p.skipWhitespace()
+	p.expect(lexer.KindEqual)
+	p.skipWhitespace()
+
+	value := parseExpression(p, true)
+
+	return &Node{
+		Kind:      KindAssign,
+		Children:  []*Node{variable, value},
+		StartLine: variable.StartLine,
+		EndLine:   value.EndLine,
+	}
+}
+
 func parseOperator(p *parser) *Node {
 	token := p.next()
 	node := &Node{
@@ -564,9 +1214,14 @@ func parseOperator(p *parser) *Node {
 		token = p.expect(lexer.KindEqual)
 		node.Value += "="
 	case lexer.KindOpenAngle, lexer.KindCloseAngle:
-		if p.peek().Kind == lexer.KindEqual {
+		switch p.peek().Kind {
+		case lexer.KindEqual:
 			token = p.expect(lexer.KindEqual)
 			node.Value += "="
+		case token.Kind:
+			// Shifts, e.g. `<<` and `>>`
+			token = p.next()
+			node.Value += token.Value
 		}
 	}
 	node.EndLine = token.EndLine
@@ -609,10 +1264,96 @@ func parseRange(p *parser) *Node {
 	p.expect(lexer.KindIn)
 	p.skipWhitespace()
 
-	node.Children = append(node.Children, parseExpression(p, true))
+	iterable := parseExpression(p, true)
+	p.skipWhitespace()
+
+	if p.peek().Kind == lexer.KindDotDot {
+		p.expect(lexer.KindDotDot)
+		p.skipWhitespace()
+		end := parseExpression(p, true)
+
+		iterable = &Node{
+			Kind:      KindIntRange,
+			Children:  []*Node{iterable, end},
+			StartLine: iterable.StartLine,
+			EndLine:   end.EndLine,
+		}
+		p.skipWhitespace()
+	}
+
+	node.Children = append(node.Children, iterable)
+
+	// limit is only a keyword after the iterable, so it can still be used
+	// as a name elsewhere
+	if p.peek().Kind == lexer.KindIdentifier && p.peek().Value == "limit" {
+		limitToken := p.next()
+		p.skipWhitespace()
+		limit := parseExpression(p, true)
+
+		node.Children = append(node.Children, &Node{
+			Kind:      KindLimit,
+			Children:  []*Node{limit},
+			StartLine: limitToken.StartLine,
+			EndLine:   limit.EndLine,
+		})
+		p.skipWhitespace()
+	}
+
+	p.expect(lexer.KindRightDelim)
+
+	p.rangeDepth++
+	node.Children = append(node.Children, parseBlock(p))
+	p.rangeDepth--
+	p.skipWhitespace()
+
+	if p.peek().Kind == lexer.KindElse {
+		p.expect(lexer.KindElse)
+		p.skipWhitespace()
+		p.expect(lexer.KindRightDelim)
+		// else case, for when there's nothing to iterate over
+		node.Children = append(node.Children, parseBlock(p))
+		p.skipWhitespace()
+	}
+
+	p.expect(lexer.KindEnd)
+
+	return node
+}
+
+func parseWith(p *parser) *Node {
+	withToken := p.expect(lexer.KindWith)
+	node := &Node{
+		Kind:      KindWith,
+		StartLine: withToken.StartLine,
+		EndLine:   withToken.EndLine,
+	}
+
+	p.expect(lexer.KindSpace)
+	p.skipWhitespace()
+
+	// The value can also be assigned to a variable, e.g. `with $s = settings`
+	if p.peek().Kind == lexer.KindVariable && p.isAssignment() {
+		node.Children = append(node.Children, parseAssignment(p))
+	} else {
+		node.Children = append(node.Children, parseExpression(p, true))
+	}
+	p.skipWhitespace()
 	p.expect(lexer.KindRightDelim)
+
+	p.withDepth++
 	node.Children = append(node.Children, parseBlock(p))
+	p.withDepth--
 	p.skipWhitespace()
+
+	if p.peek().Kind == lexer.KindElse {
+		p.expect(lexer.KindElse)
+		p.skipWhitespace()
+		p.expect(lexer.KindRightDelim)
+		// else case, for when the value is nil
+		node.Children = append(node.Children, parseBlock(p))
+		p.skipWhitespace()
+	}
+
 	p.expect(lexer.KindEnd)
 
 	return node
@@ -633,13 +1374,15 @@ func parseBlock(p *parser) *Node {
 }
 
 func parseMap(p *parser) *Node {
-	p.skipWhitespace()
+	// The opening curly has already been consumed, start on its line
 	mapNode := &Node{
 		Kind:      KindMap,
-		StartLine: p.peek().StartLine,
+		StartLine: p.lexer.Tokens[p.pos].StartLine,
 	}
+	p.skipWhitespace()
 
 	pairs := make([]*Node, 0)
+	seen := make(map[string]bool)
 	for {
 		if p.peek().Kind == lexer.KindCloseCurly {
 			break
@@ -649,17 +1392,27 @@ func parseMap(p *parser) *Node {
 			p.errorWithLoc("unexpected EOF")
 		}
 
-		key := p.expect(lexer.KindIdentifier)
+		keyPos := p.pos
+		key := parseMapKey(p)
+
+		if name, ok := staticMapKey(key); ok {
+			if seen[name] {
+				// Rewind so the error points at the duplicate key
+				p.pos = keyPos + 1
+				p.panicWithMessage(fmt.Sprintf("duplicate map key '%s'", name))
+			}
+
+			seen[name] = true
+		}
+
+		p.skipWhitespace()
 		p.expect(lexer.KindColon)
 		p.skipWhitespace()
 		value := parseExpression(p, true)
 
 		pair := &Node{
-			Kind: KindPair,
-			Children: []*Node{
-				{Kind: KindIdentifier, Value: key.Value, StartLine: key.StartLine, EndLine: key.EndLine},
-				value,
-			},
+			Kind:      KindPair,
+			Children:  []*Node{key, value},
 			StartLine: key.StartLine,
 			EndLine:   value.EndLine,
 		}
@@ -682,3 +1435,84 @@ func parseMap(p *parser) *Node {
 
 	return mapNode
 }
+
+// staticMapKey returns the name of a map key that is known at parse time,
+// which excludes computed keys.
+func staticMapKey(key *Node) (string, bool) {
+	switch key.Kind {
+	case KindIdentifier:
+		return key.Value, true
+	case KindString:
+		return key.Value[1 : len(key.Value)-1], true
+	default:
+		return "", false
+	}
+}
+
+func parseList(p *parser) *Node {
+	// The opening bracket has already been consumed, start on its line
+	listNode := &Node{
+		Kind:      KindList,
+		StartLine: p.lexer.Tokens[p.pos].StartLine,
+	}
+	p.skipWhitespace()
+
+	items := make([]*Node, 0)
+	for {
+		if p.peek().Kind == lexer.KindCloseBracket {
+			break
+		}
+
+		if p.peek().Kind == lexer.KindEOF {
+			p.errorWithLoc("unexpected EOF")
+		}
+
+		items = append(items, parseExpression(p, true))
+
+		// check for comma
+		p.skipWhitespace()
+		if p.peek().Kind == lexer.KindComma {
+			p.expect(lexer.KindComma)
+			p.skipWhitespace()
+		}
+	}
+
+	listNode.Children = items
+
+	listEnd := p.expect(lexer.KindCloseBracket)
+	listNode.EndLine = listEnd.EndLine
+
+	return listNode
+}
+
+// parses map literal keys, which can be identifiers, keywords, strings, or
+// expressions wrapped in parens, e.g. `foo`, `if`, `"foo-bar"`, or `(foo)`.
+func parseMapKey(p *parser) *Node {
+	if kind := p.peek().Kind; kind == lexer.KindIdentifier || kind.IsKeyword() {
+		// Keywords are treated as plain names since they're followed by a colon
+		token := p.next()
+		return &Node{Kind: KindIdentifier, Value: token.Value, StartLine: token.StartLine, EndLine: token.EndLine}
+	}
+
+	switch p.peek().Kind {
+	case lexer.KindString:
+		token := p.next()
+		return &Node{Kind: KindString, Value: token.Value, StartLine: token.StartLine, EndLine: token.EndLine}
+	case lexer.KindOpenParen:
+		token := p.expect(lexer.KindOpenParen)
+		p.skipWhitespace()
+		expression := parseExpression(p, true)
+		p.skipWhitespace()
+		end := p.expect(lexer.KindCloseParen)
+
+		return &Node{
+			Kind:      KindComputedKey,
+			Children:  []*Node{expression},
+			StartLine: token.StartLine,
+			EndLine:   end.EndLine,
+		}
+	default:
+		p.errorWithLoc("unexpected token '%v', expected map key", p.peek().Value)
+		return nil
+	}
+}
@@ -181,6 +181,24 @@ func TestParse_BrokenNestedIf(t *testing.T) {
 	require.ErrorContains(t, err, "unexpected token '!'")
 }
 
+func TestParse_LexerErrors(t *testing.T) {
+	testCases := map[string]struct {
+		input string
+		err   string
+	}{
+		"unexpected character": {input: "{{ foo @ bar }}", err: "unexpected token @ on line 1:\n{{ foo @ bar }}"},
+		"later line":           {input: "<p>\n{{ foo ~ bar }}</p>", err: "unexpected token ~ on line 2:\n{{ foo ~ bar }}</p>"},
+		"unclosed action":      {input: "{{ foo", err: "unclosed {{ opened on line 1:\n{{ foo"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(lexer.Lex(tc.input))
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
 func TestParse_String(t *testing.T) {
 	l := lexer.Lex(`{{if name != "Fox"}}{{end}}`)
 	result, err := Parse(l)
@@ -394,6 +412,28 @@ func TestParse_ChainCall(t *testing.T) {
 	require.Equal(t, expected.String(), result.String())
 }
 
+func TestParse_CallThenAccess(t *testing.T) {
+	l := lexer.Lex(`{{currentUser().Name.First}}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindAccess, "", []*Node{
+				n(KindAccess, "", []*Node{
+					n(KindCall, "", []*Node{
+						n(KindIdentifier, "currentUser", nil),
+					}),
+					n(KindIdentifier, "Name", nil),
+				}),
+				n(KindIdentifier, "First", nil),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
 func TestParse_Hash(t *testing.T) {
 	l := lexer.Lex(`{{ {foo: 1, bar: "2"} }}`)
 	result, err := Parse(l)
@@ -457,6 +497,868 @@ func TestParse_EmptyMap(t *testing.T) {
 	require.Equal(t, expected.String(), result.String())
 }
 
+func TestParse_MapKeywordAndStringKeys(t *testing.T) {
+	l := lexer.Lex(`{{ {if: cond, "data-id": id} }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindMap, "", []*Node{
+				n(KindPair, "", []*Node{
+					n(KindIdentifier, "if", nil),
+					n(KindIdentifier, "cond", nil),
+				}),
+				n(KindPair, "", []*Node{
+					n(KindString, `"data-id"`, nil),
+					n(KindIdentifier, "id", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_MapKeywordKeys(t *testing.T) {
+	keys := []string{"if", "block", "define", "case", "switch", "do", "capture", "defined", "slot", "yield", "in", "with"}
+
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			result, err := Parse(lexer.Lex("{{ {" + key + ": 1} }}"))
+			require.NoError(t, err)
+
+			expected := n(KindRoot, "", []*Node{
+				n(KindStatement, "", []*Node{
+					n(KindMap, "", []*Node{
+						n(KindPair, "", []*Node{
+							n(KindIdentifier, key, nil),
+							n(KindInt, "1", nil),
+						}),
+					}),
+				}),
+			})
+
+			require.Equal(t, expected.String(), result.String())
+		})
+	}
+}
+
+func TestParse_MapDuplicateKeys(t *testing.T) {
+	l := lexer.Lex("{{ {\n\tid: 1,\n\t\"id\": 2\n} }}")
+	_, err := Parse(l)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error on line 3 - duplicate map key 'id':\n\t\"id\": 2")
+}
+
+func TestParse_NestedMaps(t *testing.T) {
+	l := lexer.Lex(`{{ {user: {name: {first: First}}, tags: [{id: 1}]} }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindMap, "", []*Node{
+				n(KindPair, "", []*Node{
+					n(KindIdentifier, "user", nil),
+					n(KindMap, "", []*Node{
+						n(KindPair, "", []*Node{
+							n(KindIdentifier, "name", nil),
+							n(KindMap, "", []*Node{
+								n(KindPair, "", []*Node{
+									n(KindIdentifier, "first", nil),
+									n(KindIdentifier, "First", nil),
+								}),
+							}),
+						}),
+					}),
+				}),
+				n(KindPair, "", []*Node{
+					n(KindIdentifier, "tags", nil),
+					n(KindList, "", []*Node{
+						n(KindMap, "", []*Node{
+							n(KindPair, "", []*Node{
+								n(KindIdentifier, "id", nil),
+								n(KindInt, "1", nil),
+							}),
+						}),
+					}),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_NestedMapLines(t *testing.T) {
+	l := lexer.Lex("{{ {\n\tuser: {\n\t\tname: Name\n\t}\n} }}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	outer := result.Children[0].Children[0]
+	require.Equal(t, KindMap, outer.Kind)
+	require.Equal(t, 1, outer.StartLine)
+	require.Equal(t, 5, outer.EndLine)
+
+	inner := outer.Children[0].Children[1]
+	require.Equal(t, KindMap, inner.Kind)
+	require.Equal(t, 2, inner.StartLine)
+	require.Equal(t, 4, inner.EndLine)
+
+	_, err = Parse(lexer.Lex("{{ {\n\tuser: {\n\t\tname: ]\n\t}\n} }}"))
+	require.ErrorContains(t, err, "on line 3")
+}
+
+func TestParse_OptionalAccess(t *testing.T) {
+	l := lexer.Lex(`{{ user?.Address.City }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindAccess, OptionalAccess, []*Node{
+				n(KindAccess, OptionalAccess, []*Node{
+					n(KindIdentifier, "user", nil),
+					n(KindIdentifier, "Address", nil),
+				}),
+				n(KindIdentifier, "City", nil),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_Ternary(t *testing.T) {
+	l := lexer.Lex(`{{ a == 1 ? "one" : "other" }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindTernary, "", []*Node{
+				n(KindInfix, "", []*Node{
+					n(KindIdentifier, "a", nil),
+					n(KindOperator, "==", nil),
+					n(KindInt, "1", nil),
+				}),
+				n(KindString, `"one"`, nil),
+				n(KindString, `"other"`, nil),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_NestedTernary(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		expected *Node
+	}{
+		"false branch": {
+			template: `{{ a ? b : c ? d : e }}`,
+			expected: n(KindTernary, "", []*Node{
+				n(KindIdentifier, "a", nil),
+				n(KindIdentifier, "b", nil),
+				n(KindTernary, "", []*Node{
+					n(KindIdentifier, "c", nil),
+					n(KindIdentifier, "d", nil),
+					n(KindIdentifier, "e", nil),
+				}),
+			}),
+		},
+		"true branch": {
+			template: `{{ a ? b ? c : d : e }}`,
+			expected: n(KindTernary, "", []*Node{
+				n(KindIdentifier, "a", nil),
+				n(KindTernary, "", []*Node{
+					n(KindIdentifier, "b", nil),
+					n(KindIdentifier, "c", nil),
+					n(KindIdentifier, "d", nil),
+				}),
+				n(KindIdentifier, "e", nil),
+			}),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result, err := Parse(lexer.Lex(tc.template))
+			require.NoError(t, err)
+
+			expected := n(KindRoot, "", []*Node{
+				n(KindStatement, "", []*Node{tc.expected}),
+			})
+
+			require.Equal(t, expected.String(), result.String())
+		})
+	}
+}
+
+func TestParse_NullCoalesce(t *testing.T) {
+	l := lexer.Lex(`{{ a + b ?? c ?? "d" }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindNullCoalesce, "", []*Node{
+				n(KindNullCoalesce, "", []*Node{
+					n(KindInfix, "", []*Node{
+						n(KindIdentifier, "a", nil),
+						n(KindOperator, "+", nil),
+						n(KindIdentifier, "b", nil),
+					}),
+					n(KindIdentifier, "c", nil),
+				}),
+				n(KindString, `"d"`, nil),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_Pipe(t *testing.T) {
+	l := lexer.Lex(`{{ name | trim | format("%s!") }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindCall, "", []*Node{
+				n(KindIdentifier, "format", nil),
+				n(KindCall, "", []*Node{
+					n(KindIdentifier, "trim", nil),
+					n(KindIdentifier, "name", nil),
+				}),
+				n(KindString, `"%s!"`, nil),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_PipeInvalidTarget(t *testing.T) {
+	_, err := Parse(lexer.Lex(`{{ name | "upper" }}`))
+	require.ErrorContains(t, err, "expected function after `|`, got string")
+
+	_, err = Parse(lexer.Lex(`{{ flags | 2 }}`))
+	require.ErrorContains(t, err, "expected function after `|`, got int, use bitor for bitwise or")
+}
+
+func TestParse_Do(t *testing.T) {
+	testCases := map[string]string{
+		"repeated do":        `{{ do a(); do $b = 1 }}`,
+		"single do":          `{{ do a(); $b = 1 }}`,
+		"trailing separator": `{{ do a(); $b = 1; }}`,
+	}
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindDo, "", []*Node{
+				n(KindCall, "", []*Node{
+					n(KindIdentifier, "a", nil),
+				}),
+				n(KindAssign, "", []*Node{
+					n(KindVariable, "$b", nil),
+					n(KindInt, "1", nil),
+				}),
+			}),
+		}),
+	})
+
+	for name, template := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result, err := Parse(lexer.Lex(template))
+			require.NoError(t, err)
+
+			require.Equal(t, expected.String(), result.String())
+		})
+	}
+}
+
+func TestParse_Switch(t *testing.T) {
+	l := lexer.Lex(`{{switch status}}
+{{case "active"}}Active{{case "pending", "new"}}Pending{{else}}Unknown{{end}}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindSwitch, "", []*Node{
+				n(KindIdentifier, "status", nil),
+				n(KindCase, "", []*Node{
+					n(KindString, `"active"`, nil),
+					n(KindBlock, "", []*Node{n(KindText, "Active", nil)}),
+				}),
+				n(KindCase, "", []*Node{
+					n(KindString, `"pending"`, nil),
+					n(KindString, `"new"`, nil),
+					n(KindBlock, "", []*Node{n(KindText, "Pending", nil)}),
+				}),
+				n(KindBlock, "", []*Node{n(KindText, "Unknown", nil)}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_SwitchErrors(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		err      string
+	}{
+		"content before case": {template: `{{switch a}}hi{{case 1}}{{end}}`, err: "unexpected content before first `case`"},
+		"case after else":     {template: `{{switch a}}{{case 1}}{{else}}{{case 2}}{{end}}`, err: "unexpected `case` after `else`"},
+		"case outside switch": {template: `{{case 1}}`, err: "unexpected `case` without a matching block"},
+		"missing end":         {template: `{{switch a}}{{case 1}}`, err: "expected 'end'"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(lexer.Lex(tc.template))
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestParse_DefinedAndLogicalOperators(t *testing.T) {
+	l := lexer.Lex(`{{ defined Errors && len(Errors) > 0 || a == 1 }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindInfix, "", []*Node{
+				n(KindInfix, "", []*Node{
+					n(KindDefined, "", []*Node{
+						n(KindIdentifier, "Errors", nil),
+					}),
+					n(KindOperator, "&&", nil),
+					n(KindInfix, "", []*Node{
+						n(KindCall, "", []*Node{
+							n(KindIdentifier, "len", nil),
+							n(KindIdentifier, "Errors", nil),
+						}),
+						n(KindOperator, ">", nil),
+						n(KindInt, "0", nil),
+					}),
+				}),
+				n(KindOperator, "||", nil),
+				n(KindInfix, "", []*Node{
+					n(KindIdentifier, "a", nil),
+					n(KindOperator, "==", nil),
+					n(KindInt, "1", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_DefinedRequiresName(t *testing.T) {
+	_, err := Parse(lexer.Lex(`{{ defined "foo" }}`))
+	require.ErrorContains(t, err, "expected identifier or variable after `defined`, got `\"foo\"`")
+}
+
 func n(kind string, value string, children []*Node) *Node {
 	return &Node{Kind: kind, Value: value, Children: children}
 }
+
+func TestParse_Assignment(t *testing.T) {
+	l := lexer.Lex(`{{ $foo = bar.baz }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindAssign, "", []*Node{
+				n(KindVariable, "$foo", nil),
+				n(KindAccess, "", []*Node{
+					n(KindIdentifier, "bar", nil),
+					n(KindIdentifier, "baz", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_AssignmentNonVariable(t *testing.T) {
+	l := lexer.Lex(`{{ foo = bar }}`)
+	_, err := Parse(l)
+	require.Error(t, err)
+	require.ErrorContains(t, err, "can't assign to `foo`, variables must start with $")
+}
+
+func TestParse_LetAssignment(t *testing.T) {
+	l := lexer.Lex(`{{ let $total = a + b }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindAssign, "", []*Node{
+				n(KindVariable, "$total", nil),
+				n(KindInfix, "", []*Node{
+					n(KindIdentifier, "a", nil),
+					n(KindOperator, "+", nil),
+					n(KindIdentifier, "b", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+
+	_, err = Parse(lexer.Lex(`{{ let $total }}`))
+	require.ErrorContains(t, err, "expected assignment after `let`")
+
+	// let is only a keyword when followed by a variable
+	_, err = Parse(lexer.Lex(`{{ let total = 1 }}`))
+	require.ErrorContains(t, err, "unexpected token 'total'")
+}
+
+func TestParse_RangeCall(t *testing.T) {
+	l := lexer.Lex("{{range $tag in user.Tags()}}1{{end}}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindRange, "", []*Node{
+				n(KindVariable, "$tag", nil),
+				n(KindCall, "", []*Node{
+					n(KindAccess, "", []*Node{
+						n(KindIdentifier, "user", nil),
+						n(KindIdentifier, "Tags", nil),
+					}),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindText, "1", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_HashKeys(t *testing.T) {
+	l := lexer.Lex(`{{ {foo: 1, "bar-baz": 2, (qux): 3} }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindMap, "", []*Node{
+				n(KindPair, "", []*Node{
+					n(KindIdentifier, `foo`, nil),
+					n(KindInt, "1", nil),
+				}),
+				n(KindPair, "", []*Node{
+					n(KindString, `"bar-baz"`, nil),
+					n(KindInt, "2", nil),
+				}),
+				n(KindPair, "", []*Node{
+					n(KindComputedKey, "", []*Node{
+						n(KindIdentifier, `qux`, nil),
+					}),
+					n(KindInt, "3", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_UnmatchedEnd(t *testing.T) {
+	l := lexer.Lex("foo\n{{end}}bar")
+	_, err := Parse(l)
+	require.Error(t, err)
+	require.ErrorContains(t, err, "unexpected `end` without a matching block: on line 2")
+}
+
+func TestParse_TextAfterComment(t *testing.T) {
+	l := lexer.Lex("{{ // comment }}foo{{ bar // comment }}baz")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindText, "foo", nil),
+		n(KindStatement, "", []*Node{
+			n(KindIdentifier, "bar", nil),
+		}),
+		n(KindText, "baz", nil),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_RangeElse(t *testing.T) {
+	l := lexer.Lex("{{range $foo in data}}1{{else}}2{{end}}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindRange, "", []*Node{
+				n(KindVariable, "$foo", nil),
+				n(KindIdentifier, "data", nil),
+				n(KindBlock, "", []*Node{
+					n(KindText, "1", nil),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindText, "2", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_RangeInts(t *testing.T) {
+	l := lexer.Lex("{{range $i in 1..count}}1{{end}}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindRange, "", []*Node{
+				n(KindVariable, "$i", nil),
+				n(KindIntRange, "", []*Node{
+					n(KindInt, "1", nil),
+					n(KindIdentifier, "count", nil),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindText, "1", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_RangeLimit(t *testing.T) {
+	l := lexer.Lex("{{range $i, $v in items limit 5}}1{{else}}2{{end}}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindRange, "", []*Node{
+				n(KindVariable, "$i", nil),
+				n(KindVariable, "$v", nil),
+				n(KindIdentifier, "items", nil),
+				n(KindLimit, "", []*Node{
+					n(KindInt, "5", nil),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindText, "1", nil),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindText, "2", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+
+	// limit can still be used as a name
+	_, err = Parse(lexer.Lex("{{range $i in limit}}1{{end}}{{ limit }}"))
+	require.NoError(t, err)
+}
+
+func TestParse_Break(t *testing.T) {
+	l := lexer.Lex("{{range $foo in data}}{{break}}{{end}}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindRange, "", []*Node{
+				n(KindVariable, "$foo", nil),
+				n(KindIdentifier, "data", nil),
+				n(KindBlock, "", []*Node{
+					n(KindStatement, "", []*Node{
+						n(KindBreak, "", nil),
+					}),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_BreakOutsideRange(t *testing.T) {
+	testCases := map[string]string{
+		"root":       "{{break}}",
+		"if":         "{{if foo}}\n{{break}}{{end}}",
+		"range else": "{{range $foo in data}}1{{else}}\n{{break}}{{end}}",
+	}
+
+	// Outside of a range, break is data named break
+	for name, input := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result, err := Parse(lexer.Lex(input))
+			require.NoError(t, err)
+			require.Contains(t, result.String(), "(identifier `break`)")
+			require.NotContains(t, result.String(), "(break)")
+		})
+	}
+}
+
+func TestParse_ContinueOutsideRange(t *testing.T) {
+	// Outside of a range, continue is data named continue
+	result, err := Parse(lexer.Lex("{{if foo}}\n{{continue}}{{end}}"))
+	require.NoError(t, err)
+	require.Contains(t, result.String(), "(identifier `continue`)")
+
+	result, err = Parse(lexer.Lex("{{range $foo in data}}{{if $foo}}{{continue}}{{end}}{{end}}"))
+	require.NoError(t, err)
+	require.Contains(t, result.String(), "(continue)")
+}
+
+func TestParse_Slice(t *testing.T) {
+	testCases := map[string]struct {
+		input string
+		low   *Node
+		high  *Node
+	}{
+		"both": {input: "{{items[1:3]}}", low: n(KindInt, "1", nil), high: n(KindInt, "3", nil)},
+		"low":  {input: "{{items[ 1 : ]}}", low: n(KindInt, "1", nil)},
+		"high": {input: "{{items[:$end]}}", high: n(KindVariable, "$end", nil)},
+		"none": {input: "{{items[:]}}"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result, err := Parse(lexer.Lex(tc.input))
+			require.NoError(t, err)
+
+			expected := n(KindRoot, "", []*Node{
+				n(KindStatement, "", []*Node{
+					n(KindSlice, "", []*Node{
+						n(KindIdentifier, "items", nil),
+						tc.low,
+						tc.high,
+					}),
+				}),
+			})
+
+			require.Equal(t, expected.String(), result.String())
+		})
+	}
+}
+
+func TestParse_InList(t *testing.T) {
+	l := lexer.Lex(`{{status in ["open", 1]}}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindInfix, "", []*Node{
+				n(KindIdentifier, "status", nil),
+				n(KindOperator, "in", nil),
+				n(KindList, "", []*Node{
+					n(KindString, `"open"`, nil),
+					n(KindInt, "1", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_WithVariable(t *testing.T) {
+	l := lexer.Lex("{{with $a = order.Address}}{{$a.City}}{{end}}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindWith, "", []*Node{
+				n(KindAssign, "", []*Node{
+					n(KindVariable, "$a", nil),
+					n(KindAccess, "", []*Node{
+						n(KindIdentifier, "order", nil),
+						n(KindIdentifier, "Address", nil),
+					}),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindStatement, "", []*Node{
+						n(KindAccess, "", []*Node{
+							n(KindVariable, "$a", nil),
+							n(KindIdentifier, "City", nil),
+						}),
+					}),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_With(t *testing.T) {
+	l := lexer.Lex("{{with order.Address}}{{.City}}{{.}}{{else}}none{{end}}")
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindWith, "", []*Node{
+				n(KindAccess, "", []*Node{
+					n(KindIdentifier, "order", nil),
+					n(KindIdentifier, "Address", nil),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindStatement, "", []*Node{
+						n(KindAccess, "", []*Node{
+							n(KindContext, ".", nil),
+							n(KindIdentifier, "City", nil),
+						}),
+					}),
+					n(KindStatement, "", []*Node{
+						n(KindContext, ".", nil),
+					}),
+				}),
+				n(KindBlock, "", []*Node{
+					n(KindText, "none", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_ContextOutsideWith(t *testing.T) {
+	_, err := Parse(lexer.Lex("{{with foo}}{{end}}\n{{.City}}"))
+	require.ErrorContains(t, err, "`.` can only be used inside of with or range: on line 2")
+}
+
+func TestParse_ContextInRange(t *testing.T) {
+	_, err := Parse(lexer.Lex("{{range $i in items}}{{.Name}}{{end}}"))
+	require.NoError(t, err)
+
+	_, err = Parse(lexer.Lex("{{range $i in items}}{{end}}{{.}}"))
+	require.ErrorContains(t, err, "`.` can only be used inside of with or range: on line 1")
+}
+
+func TestParse_SlotAndYield(t *testing.T) {
+	l := lexer.Lex(`{{slot "scripts"}}<script></script>{{end}}{{yield "scripts"}}{{yield("styles")}}{{yield}}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindSlot, "", []*Node{
+				n(KindString, `"scripts"`, nil),
+				n(KindBlock, "", []*Node{n(KindText, "<script></script>", nil)}),
+			}),
+		}),
+		n(KindStatement, "", []*Node{
+			n(KindYield, "", []*Node{n(KindString, `"scripts"`, nil)}),
+		}),
+		n(KindStatement, "", []*Node{
+			n(KindYield, "", []*Node{n(KindString, `"styles"`, nil)}),
+		}),
+		n(KindStatement, "", []*Node{
+			n(KindYield, "", nil),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_Capture(t *testing.T) {
+	l := lexer.Lex(`{{capture $sidebar}}<nav>{{name}}</nav>{{end}}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindCapture, "", []*Node{
+				n(KindVariable, "$sidebar", nil),
+				n(KindBlock, "", []*Node{
+					n(KindText, "<nav>", nil),
+					n(KindStatement, "", []*Node{n(KindIdentifier, "name", nil)}),
+					n(KindText, "</nav>", nil),
+				}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+
+	_, err = Parse(lexer.Lex(`{{capture sidebar}}{{end}}`))
+	require.ErrorContains(t, err, "expected variable after `capture`, got `sidebar`")
+}
+
+func TestParse_Raw(t *testing.T) {
+	l := lexer.Lex(`{{ raw }}{{ name }}{{ end }}{{ name }}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{n(KindRaw, "{{ name }}", nil)}),
+		n(KindStatement, "", []*Node{n(KindIdentifier, "name", nil)}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_BlockAndDefine(t *testing.T) {
+	l := lexer.Lex(`{{block "sidebar"}}default{{end}}{{define "sidebar"}}custom{{end}}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindBlockDef, "", []*Node{
+				n(KindString, `"sidebar"`, nil),
+				n(KindBlock, "", []*Node{n(KindText, "default", nil)}),
+			}),
+		}),
+		n(KindStatement, "", []*Node{
+			n(KindDefine, "", []*Node{
+				n(KindString, `"sidebar"`, nil),
+				n(KindBlock, "", []*Node{n(KindText, "custom", nil)}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
+
+func TestParse_ContentFor(t *testing.T) {
+	l := lexer.Lex(`{{contentFor("sidebar")}}<nav></nav>{{end}}`)
+	result, err := Parse(l)
+	require.NoError(t, err)
+
+	expected := n(KindRoot, "", []*Node{
+		n(KindStatement, "", []*Node{
+			n(KindSlot, "", []*Node{
+				n(KindString, `"sidebar"`, nil),
+				n(KindBlock, "", []*Node{n(KindText, "<nav></nav>", nil)}),
+			}),
+		}),
+	})
+
+	require.Equal(t, expected.String(), result.String())
+}
@@ -7,10 +7,36 @@ import (
 )
 
 // These functions are somehat naive and assumes that the right-most type
-// should be the cast target. A more comprehensive implementation
-// would be very welcome.
+// should be the cast target unless the left-most type is a float. A more
+// comprehensive implementation would be very welcome.
 
-func subtract(a any, b any) any {
+// convertOperands converts the operands of an arithmetic operation to the same
+// type. Integers are promoted to the type of a float operand so that fractions
+// aren't lost, e.g. 1.5 * 2 is 3, otherwise the left operand is converted to the
+// type of the right operand. In strict mode, numbers of different types are an
+// error instead.
+func convertOperands(aValue reflect.Value, bValue reflect.Value, strict bool) (any, any) {
+	if !aValue.CanConvert(bValue.Type()) {
+		panic(fmt.Sprintf("can't convert type %s into %s", aValue.Type(), bValue.Type()))
+	}
+
+	// Strings are concatenated as-is so that Safe values aren't escaped
+	if aValue.Kind() == reflect.String || aValue.Type() == bValue.Type() {
+		return aValue.Interface(), bValue.Interface()
+	}
+
+	if strict {
+		panic(fmt.Sprintf("mismatched types %s and %s, convert one of the values with int or float before using it in math", aValue.Type(), bValue.Type()))
+	}
+
+	if genericType(aValue) == coreFloat && genericType(bValue) != coreFloat {
+		return aValue.Interface(), bValue.Convert(aValue.Type()).Interface()
+	}
+
+	return aValue.Convert(bValue.Type()).Interface(), bValue.Interface()
+}
+
+func subtract(a any, b any, strict bool) any {
 	aValue := reflect.ValueOf(a)
 	bValue := reflect.ValueOf(b)
 
@@ -18,9 +44,7 @@ func subtract(a any, b any) any {
 		panic(fmt.Sprintf("can't subtract %s from %s", aValue.Kind(), bValue.Kind()))
 	}
 
-	if !aValue.CanConvert(bValue.Type()) {
-		panic(fmt.Sprintf("can't convert type %s into %s", aValue.Type(), bValue.Type()))
-	}
+	a, b = convertOperands(aValue, bValue, strict)
 
 	switch reflect.ValueOf(b).Kind() {
 	case reflect.Int64:
@@ -56,7 +80,7 @@ func subtract(a any, b any) any {
 	}
 }
 
-func add(a any, b any, escapeFunc func(string) string) any {
+func add(a any, b any, escapeFunc func(string) string, strict bool) any {
 	aValue := reflect.ValueOf(a)
 	bValue := reflect.ValueOf(b)
 
@@ -64,9 +88,7 @@ func add(a any, b any, escapeFunc func(string) string) any {
 		panic(fmt.Sprintf("can't subtract %s from %s", aValue.Kind(), bValue.Kind()))
 	}
 
-	if !aValue.CanConvert(bValue.Type()) {
-		panic(fmt.Sprintf("can't convert type %s into %s", aValue.Type(), bValue.Type()))
-	}
+	a, b = convertOperands(aValue, bValue, strict)
 
 	if aValue.Kind() == reflect.String {
 		left := aValue.String()
@@ -117,7 +139,7 @@ func add(a any, b any, escapeFunc func(string) string) any {
 	}
 }
 
-func multiply(a any, b any) any {
+func multiply(a any, b any, strict bool) any {
 	aValue := reflect.ValueOf(a)
 	bValue := reflect.ValueOf(b)
 
@@ -125,9 +147,7 @@ func multiply(a any, b any) any {
 		panic(fmt.Sprintf("can't subtract %s from %s", aValue.Kind(), bValue.Kind()))
 	}
 
-	if !aValue.CanConvert(bValue.Type()) {
-		panic(fmt.Sprintf("can't convert type %s into %s", aValue.Type(), bValue.Type()))
-	}
+	a, b = convertOperands(aValue, bValue, strict)
 
 	switch reflect.ValueOf(b).Kind() {
 	case reflect.Int64:
@@ -163,7 +183,7 @@ func multiply(a any, b any) any {
 	}
 }
 
-func divide(a any, b any) any {
+func divide(a any, b any, strict bool) any {
 	aValue := reflect.ValueOf(a)
 	bValue := reflect.ValueOf(b)
 
@@ -171,9 +191,7 @@ func divide(a any, b any) any {
 		panic(fmt.Sprintf("can't subtract %s from %s", aValue.Kind(), bValue.Kind()))
 	}
 
-	if !aValue.CanConvert(bValue.Type()) {
-		panic(fmt.Sprintf("can't convert type %s into %s", aValue.Type(), bValue.Type()))
-	}
+	a, b = convertOperands(aValue, bValue, strict)
 
 	switch reflect.ValueOf(b).Kind() {
 	case reflect.Int64:
@@ -209,7 +227,7 @@ func divide(a any, b any) any {
 	}
 }
 
-func modulo(a any, b any) any {
+func modulo(a any, b any, strict bool) any {
 	aValue := reflect.ValueOf(a)
 	bValue := reflect.ValueOf(b)
 
@@ -217,9 +235,7 @@ func modulo(a any, b any) any {
 		panic(fmt.Sprintf("can't subtract %s from %s", aValue.Kind(), bValue.Kind()))
 	}
 
-	if !aValue.CanConvert(bValue.Type()) {
-		panic(fmt.Sprintf("can't convert type %s into %s", aValue.Type(), bValue.Type()))
-	}
+	a, b = convertOperands(aValue, bValue, strict)
 
 	switch reflect.ValueOf(b).Kind() {
 	case reflect.Int64:
@@ -243,10 +259,76 @@ func modulo(a any, b any) any {
 	case reflect.Uint:
 		return a.(uint) % b.(uint)
 	case reflect.Float32:
-		return math.Mod(a.(float64), b.(float64))
+		return float32(math.Mod(float64(a.(float32)), float64(b.(float32))))
 	case reflect.Float64:
 		return math.Mod(a.(float64), b.(float64))
 	default:
 		panic(fmt.Sprintf("can't subtract %s from %s", aValue.Kind(), bValue.Kind()))
 	}
 }
+
+// bitwise applies the bitwise operator op to the integers a and b. Like the
+// other operators, a is converted to the type of b, except for shifts which
+// keep the type of a. `|` is only used by the bitor helper, since it's the pipe
+// operator in templates.
+func bitwise(op string, a any, b any) (any, error) {
+	aValue := reflect.ValueOf(a)
+	bValue := reflect.ValueOf(b)
+
+	aType := genericType(aValue)
+	bType := genericType(bValue)
+	if (aType != coreInt && aType != coreUint) || (bType != coreInt && bType != coreUint) {
+		return nil, fmt.Errorf("can't use %s on %s and %s, both must be integers", op, aValue.Kind(), bValue.Kind())
+	}
+
+	if op == "<<" || op == ">>" {
+		if bType == coreInt && bValue.Int() < 0 {
+			return nil, fmt.Errorf("can't shift by negative amount %d", bValue.Int())
+		}
+
+		shift := bValue.Convert(reflect.TypeOf(uint64(0))).Uint()
+		result := reflect.New(aValue.Type()).Elem()
+
+		switch {
+		case aType == coreInt && op == "<<":
+			result.SetInt(aValue.Int() << shift)
+		case aType == coreInt:
+			result.SetInt(aValue.Int() >> shift)
+		case op == "<<":
+			result.SetUint(aValue.Uint() << shift)
+		default:
+			result.SetUint(aValue.Uint() >> shift)
+		}
+
+		return result.Interface(), nil
+	}
+
+	aValue = aValue.Convert(bValue.Type())
+	result := reflect.New(bValue.Type()).Elem()
+
+	if bType == coreInt {
+		x, y := aValue.Int(), bValue.Int()
+
+		switch op {
+		case "&":
+			result.SetInt(x & y)
+		case "^":
+			result.SetInt(x ^ y)
+		case "|":
+			result.SetInt(x | y)
+		}
+	} else {
+		x, y := aValue.Uint(), bValue.Uint()
+
+		switch op {
+		case "&":
+			result.SetUint(x & y)
+		case "^":
+			result.SetUint(x ^ y)
+		case "|":
+			result.SetUint(x | y)
+		}
+	}
+
+	return result.Interface(), nil
+}
@@ -0,0 +1,122 @@
+package bat
+
+import (
+	"fmt"
+
+	"github.com/blakewilliams/bat/internal/parser"
+)
+
+// TemplateError represents a problem found in a template and the line it was
+// found on.
+type TemplateError struct {
+	Line    int
+	Message string
+}
+
+func (e TemplateError) Error() string {
+	return fmt.Sprintf("%s on line %d", e.Message, e.Line)
+}
+
+// conditionKinds are the node kinds that can be used as the condition of an
+// if statement.
+var conditionKinds = map[string]bool{
+	parser.KindAccess:        true,
+	parser.KindBracketAccess: true,
+	parser.KindCall:          true,
+	parser.KindContext:       true,
+	parser.KindDefined:       true,
+	parser.KindFalse:         true,
+	parser.KindIdentifier:    true,
+	parser.KindInfix:         true,
+	parser.KindInt:           true,
+	parser.KindNegate:        true,
+	parser.KindNil:           true,
+	parser.KindNot:           true,
+	parser.KindNullCoalesce:  true,
+	parser.KindSlice:         true,
+	parser.KindString:        true,
+	parser.KindTernary:       true,
+	parser.KindTrue:          true,
+	parser.KindVariable:      true,
+}
+
+// Validate checks the template for problems without executing it, returning
+// every problem found. Calls to helpers are checked against the helpers
+// provided to the template and knownHelpers, which should contain the names
+// of helpers that will be provided at execution time.
+//
+// Unmatched `{{end}}` and `{{else}}` statements are reported by NewTemplate,
+// so a template can't be created with them.
+func (t *Template) Validate(knownHelpers []string) []TemplateError {
+	known := make(map[string]bool, len(knownHelpers))
+	for _, name := range knownHelpers {
+		known[name] = true
+	}
+
+	errs := make([]TemplateError, 0)
+	t.validate(t.ast, known, &errs)
+
+	return errs
+}
+
+// Validate checks every template registered with the engine for problems
+// without executing them, returning the problems found in each template by
+// name. Calls to helpers are checked against the engine's helpers, the helpers
+// provided to every render, like partial and layout, and knownHelpers, which
+// should contain the names of helpers passed to RenderWithHelpers.
+func (e *Engine) Validate(knownHelpers []string) map[string][]TemplateError {
+	e.mu.RLock()
+	templates := make(map[string]Template, len(e.templates))
+	for name, t := range e.templates {
+		templates[name] = t
+	}
+	e.mu.RUnlock()
+
+	known := append(append([]string{}, renderHelpers...), knownHelpers...)
+	problems := make(map[string][]TemplateError)
+	for name, t := range templates {
+		if errs := t.Validate(known); len(errs) > 0 {
+			problems[name] = errs
+		}
+	}
+
+	return problems
+}
+
+func (t *Template) validate(n *parser.Node, knownHelpers map[string]bool, errs *[]TemplateError) {
+	if n == nil {
+		return
+	}
+
+	switch n.Kind {
+	case parser.KindCall:
+		callee := n.Children[0]
+		if callee.Kind == parser.KindIdentifier {
+			_, isHelper := t.helpers[callee.Value]
+
+			if !isHelper && !knownHelpers[callee.Value] {
+				*errs = append(*errs, TemplateError{
+					Line:    callee.StartLine,
+					Message: fmt.Sprintf("function '%s' not defined", callee.Value),
+				})
+			}
+		}
+	case parser.KindRange:
+		// An empty else block is fine, only the body has to render something
+		if len(splitRange(n).body.Children) == 0 {
+			*errs = append(*errs, TemplateError{Line: n.StartLine, Message: "range has an empty body"})
+		}
+	case parser.KindIf:
+		condition := n.Children[0]
+		if !conditionKinds[condition.Kind] {
+			*errs = append(*errs, TemplateError{
+				Line:    n.StartLine,
+				Message: fmt.Sprintf("invalid condition of kind %s", condition.Kind),
+			})
+		}
+	}
+
+	for _, child := range n.Children {
+		t.validate(child, knownHelpers, errs)
+	}
+}
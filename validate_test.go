@@ -0,0 +1,86 @@
+package bat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	template, err := NewTemplate(
+		"hello.html",
+		`{{if len(people) > 0}}{{range $i, $person in people}}{{upper($person)}}{{end}}{{end}}`,
+		WithHelpers(map[string]any{"len": func(v any) int { return 0 }}),
+	)
+	require.NoError(t, err)
+
+	errs := template.Validate([]string{"upper"})
+	require.Empty(t, errs)
+}
+
+func TestValidate_MissingHelper(t *testing.T) {
+	template, err := NewTemplate("hello.html", "{{ user.Name.Initials() }}\n{{ upper(name) }}")
+	require.NoError(t, err)
+
+	errs := template.Validate(nil)
+	require.Len(t, errs, 1)
+	require.Equal(t, 2, errs[0].Line)
+	require.Equal(t, "function 'upper' not defined on line 2", errs[0].Error())
+}
+
+func TestValidate_EmptyRange(t *testing.T) {
+	template, err := NewTemplate("hello.html", "{{range $i in people}}{{end}}")
+	require.NoError(t, err)
+
+	errs := template.Validate(nil)
+	require.Len(t, errs, 1)
+	require.Equal(t, "range has an empty body", errs[0].Message)
+}
+
+func TestValidate_EmptyRangeElse(t *testing.T) {
+	template, err := NewTemplate("hello.html", "{{range $i in people}}x{{else}}{{end}}")
+	require.NoError(t, err)
+
+	errs := template.Validate(nil)
+	require.Empty(t, errs)
+}
+
+func TestValidate_InvalidCondition(t *testing.T) {
+	template, err := NewTemplate("hello.html", "{{if {foo: 1}}}foo{{end}}")
+	require.NoError(t, err)
+
+	errs := template.Validate(nil)
+	require.Len(t, errs, 1)
+	require.Equal(t, "invalid condition of kind map", errs[0].Message)
+}
+
+func TestValidate_UnmatchedEnd(t *testing.T) {
+	_, err := NewTemplate("hello.html", "{{if foo}}foo{{end}}{{end}}")
+	require.Error(t, err)
+	require.ErrorContains(t, err, "unexpected `end` without a matching block")
+}
+
+func TestEngine_Validate(t *testing.T) {
+	engine := NewEngine(HTMLEscape)
+	engine.Helper("format", func(v any) string { return "" })
+	engine.MustRegister("page", `{{ layout("main") }}{{ contentFor("head", "hi") }}{{ partial("card", {id: uid("card")}) }}{{ format(upper(name)) }}`)
+	engine.MustRegister("card", `{{ track(id) }}`)
+	engine.MustRegister("main", "{{ ChildContent }}\n{{ missing() }}{{ range $i in items }}{{ end }}")
+
+	problems := engine.Validate([]string{"track"})
+	require.Equal(t, map[string][]TemplateError{
+		"main": {
+			{Line: 2, Message: "function 'missing' not defined"},
+			{Line: 2, Message: "range has an empty body"},
+		},
+	}, problems)
+
+	problems = engine.Validate(nil)
+	require.Equal(t, map[string][]TemplateError{
+		"card": {{Line: 1, Message: "function 'track' not defined"}},
+		"main": {
+			{Line: 2, Message: "function 'missing' not defined"},
+			{Line: 2, Message: "range has an empty body"},
+		},
+	}, problems)
+}
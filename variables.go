@@ -0,0 +1,95 @@
+package bat
+
+import (
+	"sort"
+
+	"github.com/blakewilliams/bat/internal/parser"
+)
+
+// Variables returns the sorted names of the data keys referenced by the
+// template. Helpers provided to the template, identifiers used as function
+// calls, and template variables like `$foo` are not included.
+func (t *Template) Variables() []string {
+	all, _ := t.collectVariables()
+
+	return all
+}
+
+// RangeVariables returns the sorted names of the data keys that are used as
+// the value being iterated over in a range statement. Each of these is also
+// included in Variables.
+func (t *Template) RangeVariables() []string {
+	_, ranged := t.collectVariables()
+
+	return ranged
+}
+
+func (t *Template) collectVariables() ([]string, []string) {
+	all := make(map[string]bool)
+	ranged := make(map[string]bool)
+
+	t.walkIdentifiers(t.ast, func(name string, isRanged bool) {
+		if _, ok := t.helpers[name]; ok {
+			return
+		}
+
+		all[name] = true
+		if isRanged {
+			ranged[name] = true
+		}
+	}, false)
+
+	return sortedKeys(all), sortedKeys(ranged)
+}
+
+// walkIdentifiers performs a depth-first walk of the AST calling fn with each
+// identifier that references data.
+func (t *Template) walkIdentifiers(n *parser.Node, fn func(name string, ranged bool), ranged bool) {
+	if n == nil {
+		return
+	}
+
+	switch n.Kind {
+	case parser.KindIdentifier:
+		fn(n.Value, ranged)
+	case parser.KindAccess:
+		// The second child is the property being accessed, not data
+		t.walkIdentifiers(n.Children[0], fn, ranged)
+	case parser.KindCall:
+		if n.Children[0].Kind != parser.KindIdentifier {
+			t.walkIdentifiers(n.Children[0], fn, ranged)
+		}
+
+		for _, arg := range n.Children[1:] {
+			t.walkIdentifiers(arg, fn, ranged)
+		}
+	case parser.KindPair:
+		if n.Children[0].Kind == parser.KindComputedKey {
+			t.walkIdentifiers(n.Children[0], fn, ranged)
+		}
+
+		t.walkIdentifiers(n.Children[1], fn, ranged)
+	case parser.KindRange:
+		r := splitRange(n)
+
+		t.walkIdentifiers(r.iterable, fn, true)
+		t.walkIdentifiers(r.limit, fn, ranged)
+		t.walkIdentifiers(r.body, fn, ranged)
+		t.walkIdentifiers(r.elseBody, fn, ranged)
+	default:
+		for _, child := range n.Children {
+			t.walkIdentifiers(child, fn, ranged)
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,27 @@
+package bat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariables(t *testing.T) {
+	template, err := NewTemplate(
+		"hello.html",
+		`{{if user.Name != nil}}{{user.Name.Initials()}}{{end}}{{range $i, $post in posts}}{{$post.Title}} {{title}}{{end}}{{format(date, {layout: layout, (key): 1})}}{{Errors["name"]}}`,
+		WithHelpers(map[string]any{"title": func() string { return "" }}),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"Errors", "date", "key", "layout", "posts", "user"}, template.Variables())
+	require.Equal(t, []string{"posts"}, template.RangeVariables())
+}
+
+func TestVariables_None(t *testing.T) {
+	template, err := NewTemplate("hello.html", `<h1>Hello</h1>`)
+	require.NoError(t, err)
+
+	require.Empty(t, template.Variables())
+	require.Empty(t, template.RangeVariables())
+}
@@ -0,0 +1,133 @@
+package bat
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/blakewilliams/bat/internal/parser"
+)
+
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+// preservedTags are the elements whose whitespace is significant, so it isn't
+// collapsed.
+var preservedTags = []string{"pre", "textarea"}
+
+// collapseWhitespace collapses runs of whitespace in the text of the given
+// AST to a single space, except for text inside of preserved tags. Text is
+// visited in the order it appears in the template, so a preserved tag opened
+// in one branch of a conditional is treated as open in the following
+// branches too.
+func collapseWhitespace(root *parser.Node) {
+	preserved := ""
+
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if n == nil {
+			return
+		}
+
+		if n.Kind == parser.KindText {
+			n.Value, preserved = collapseText(n.Value, preserved)
+			return
+		}
+
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+
+	walk(root)
+}
+
+// collapseText collapses the whitespace in s, returning the collapsed text and
+// the preserved tag that is still open at the end of s, if any.
+func collapseText(s string, preserved string) (string, string) {
+	var b strings.Builder
+
+	for len(s) > 0 {
+		if preserved != "" {
+			end := indexFold(s, "</"+preserved)
+			if end < 0 {
+				b.WriteString(s)
+				return b.String(), preserved
+			}
+
+			b.WriteString(s[:end])
+			s = s[end:]
+			preserved = ""
+			continue
+		}
+
+		start, tag := nextPreservedTag(s)
+		if start < 0 {
+			b.WriteString(whitespaceRun.ReplaceAllString(s, " "))
+			return b.String(), ""
+		}
+
+		b.WriteString(whitespaceRun.ReplaceAllString(s[:start], " "))
+		b.WriteString(s[start : start+len(tag)+1])
+		s = s[start+len(tag)+1:]
+		preserved = tag
+	}
+
+	return b.String(), preserved
+}
+
+// nextPreservedTag returns the index and name of the first preserved tag
+// opened in s, or -1 if there isn't one.
+func nextPreservedTag(s string) (int, string) {
+	first, firstTag := -1, ""
+
+	for _, tag := range preservedTags {
+		for offset := 0; ; {
+			index := indexFold(s[offset:], "<"+tag)
+			if index < 0 {
+				break
+			}
+
+			index += offset
+			end := index + len(tag) + 1
+
+			// Ignore tags that only start with the name, e.g. <preview>
+			if end < len(s) && !isTagNameEnd(s[end]) {
+				offset = end
+				continue
+			}
+
+			if first < 0 || index < first {
+				first, firstTag = index, tag
+			}
+			break
+		}
+	}
+
+	return first, firstTag
+}
+
+// indexFold returns the index of the first instance of the lowercase ASCII
+// substr in s ignoring ASCII case, or -1 if it isn't present. Only ASCII is
+// folded so that indexes into s stay valid, unlike with strings.ToLower.
+func indexFold(s string, substr string) int {
+outer:
+	for i := 0; i+len(substr) <= len(s); i++ {
+		for j := 0; j < len(substr); j++ {
+			c := s[i+j]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+
+			if c != substr[j] {
+				continue outer
+			}
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+func isTagNameEnd(c byte) bool {
+	return c == '>' || c == '/' || c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
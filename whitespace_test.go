@@ -0,0 +1,36 @@
+package bat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollapseText(t *testing.T) {
+	testCases := map[string]struct {
+		input     string
+		preserved string
+		expected  string
+		open      string
+	}{
+		"runs":         {input: "<div>\n    <p>  hi  </p>\n</div>\n", expected: "<div> <p> hi </p> </div> "},
+		"pre":          {input: "<p>  a  </p><pre>  b\n  c</pre>  <p>  d  </p>", expected: "<p> a </p><pre>  b\n  c</pre> <p> d </p>"},
+		"textarea":     {input: "<textarea name=\"x\">  a\n</TEXTAREA>  b", expected: "<textarea name=\"x\">  a\n</TEXTAREA> b"},
+		"uppercase":    {input: "<PRE>  a  </PRE>  b", expected: "<PRE>  a  </PRE> b"},
+		"unclosed":     {input: "a  <pre>  b  ", expected: "a <pre>  b  ", open: "pre"},
+		"already open": {input: "  b  </pre>  c", preserved: "pre", expected: "  b  </pre> c"},
+		"similar tag":  {input: "<preview>  a  </preview>", expected: "<preview> a </preview>"},
+		"non-ascii":    {input: "ȺȺȺȺȺȺȺȺȺȺ<pre>x</pre>", expected: "ȺȺȺȺȺȺȺȺȺȺ<pre>x</pre>"},
+		"dotted i":     {input: "İİİİ  <pre>  a  </pre>  b", expected: "İİİİ <pre>  a  </pre> b"},
+		"non-ascii in": {input: "<pre>  Ⱥ  </PRE>  Ⱥ  ", expected: "<pre>  Ⱥ  </PRE> Ⱥ "},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out, open := collapseText(tc.input, tc.preserved)
+
+			require.Equal(t, tc.expected, out)
+			require.Equal(t, tc.open, open)
+		})
+	}
+}